@@ -0,0 +1,64 @@
+// Package ansi is how boss prints: the @X{...} markup of go-ansi, drawn
+// in whatever theme the user picked.  go-ansi has no way to change what
+// its markup looks like, so themed markup is rewritten into escape
+// sequences here, before go-ansi gets to see it.
+package ansi
+
+import (
+	"io"
+	"regexp"
+
+	ansi "github.com/jhunt/go-ansi"
+)
+
+var (
+	colors = map[string]string{}
+
+	/* the same markup go-ansi looks for, so that both find the same spans */
+	markup = regexp.MustCompile(`(?s)@[kKrRgGyYbBmMpPcCwW*]{.*?}`)
+)
+
+// SetColors changes what markup (i.e. the G in @G{...}) looks like, as
+// SGR codes.  Markup it doesn't mention is drawn as go-ansi draws it.
+// SGR codes can only have two parts (i.e. 01;34), or go-ansi can't strip
+// them again when output isn't going to a terminal.
+func SetColors(m map[string]string) {
+	colors = m
+}
+
+func themed(format string) string {
+	if len(colors) == 0 {
+		return format
+	}
+	return markup.ReplaceAllStringFunc(format, func(m string) string {
+		sgr, ok := colors[m[1:2]]
+		if !ok {
+			return m
+		}
+		return "\033[" + sgr + "m" + m[3:len(m)-1] + "\033[00m"
+	})
+}
+
+func ForceColor(c bool) {
+	ansi.ForceColor(c)
+}
+
+func CanColorize(out io.Writer) bool {
+	return ansi.CanColorize(out)
+}
+
+func Printf(format string, a ...interface{}) (int, error) {
+	return ansi.Printf(themed(format), a...)
+}
+
+func Fprintf(out io.Writer, format string, a ...interface{}) (int, error) {
+	return ansi.Fprintf(out, themed(format), a...)
+}
+
+func Sprintf(format string, a ...interface{}) string {
+	return ansi.Sprintf(themed(format), a...)
+}
+
+func Errorf(format string, a ...interface{}) error {
+	return ansi.Errorf(themed(format), a...)
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+type Change struct {
+	Action   string /* create, update or delete */
+	ID       string
+	Service  string
+	Plan     string
+	FromPlan string
+	Params   map[string]interface{}
+
+	/* for updates, whether the parameters differ */
+	ParamsChanged bool
+}
+
+// Diff works out what would have to change to bring the broker in line
+// with the desired instance definitions.  Instances that aren't defined
+// are only deleted if prune is set, and instances defined without any
+// params keep whatever parameters they already have.
+func (c *Client) Diff(desired Definitions, prune bool) ([]Change, error) {
+	current, err := c.Export()
+	if err != nil {
+		return nil, err
+	}
+	have := make(map[string]Definition)
+	for _, d := range current.Instances {
+		have[d.ID] = d
+	}
+
+	changes := make([]Change, 0)
+	want := make(map[string]bool)
+	for _, d := range desired.Instances {
+		if d.ID == "" {
+			return nil, fmt.Errorf("%s/%s instance has no id; every instance must have one to be applied", d.Service, d.Plan)
+		}
+		want[d.ID] = true
+
+		existing, ok := have[d.ID]
+		if !ok {
+			changes = append(changes, Change{Action: "create", ID: d.ID, Service: d.Service, Plan: d.Plan, Params: d.Params})
+			continue
+		}
+
+		if existing.Service != d.Service {
+			return nil, fmt.Errorf("instance '%s' is a %s instance, and cannot be turned into a %s instance", d.ID, existing.Service, d.Service)
+		}
+
+		paramsChanged := len(d.Params) > 0 && !sameParams(existing.Params, d.Params)
+		if existing.Plan != d.Plan || paramsChanged {
+			changes = append(changes, Change{
+				Action:        "update",
+				ID:            d.ID,
+				Service:       d.Service,
+				Plan:          d.Plan,
+				FromPlan:      existing.Plan,
+				Params:        d.Params,
+				ParamsChanged: paramsChanged,
+			})
+		}
+	}
+
+	if prune {
+		for _, d := range current.Instances {
+			if !want[d.ID] {
+				changes = append(changes, Change{Action: "delete", ID: d.ID, Service: d.Service, Plan: d.Plan})
+			}
+		}
+	}
+
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].ID < changes[j].ID
+	})
+	return changes, nil
+}
+
+/* compare parameters as JSON would, so 3 and 3.0 are the same */
+func sameParams(a, b map[string]interface{}) bool {
+	var x, y interface{}
+	ja, _ := json.Marshal(a)
+	jb, _ := json.Marshal(b)
+	json.Unmarshal(ja, &x)
+	json.Unmarshal(jb, &y)
+	return reflect.DeepEqual(x, y)
+}
+
+func (c *Client) Apply(change Change) error {
+	switch change.Action {
+	case "create":
+		service, plan, err := c.Plan(change.Service, change.Plan)
+		if err != nil {
+			return err
+		}
+		_, err = c.CreateAndWait(change.ID, service.ID, plan.ID, ProvisionOptions{Parameters: change.Params}, 0)
+		return err
+
+	case "update":
+		if change.Plan != change.FromPlan {
+			_, plan, err := c.Plan(change.Service, change.Plan)
+			if err != nil {
+				return err
+			}
+			if _, err := c.ChangePlanAndWait(change.ID, plan.ID, 0); err != nil {
+				return err
+			}
+		}
+		if change.ParamsChanged {
+			_, err := c.UpdateAndWait(change.ID, ProvisionOptions{Parameters: change.Params}, 0)
+			return err
+		}
+		return nil
+
+	case "delete":
+		return c.DeleteAndWait(change.ID, 0)
+	}
+	return fmt.Errorf("unrecognized change '%s'", change.Action)
+}
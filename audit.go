@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AuditConfig is where a target's audit trail goes: a local file of
+// JSON lines, an HTTP webhook that each entry is POSTed to, or both.
+type AuditConfig struct {
+	File    string            `json:"file,omitempty"`
+	Webhook string            `json:"webhook,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"` /* i.e. Authorization, for the webhook */
+}
+
+// AuditEntry is a structured record of one change made through boss.
+type AuditEntry struct {
+	Time      time.Time `json:"time"`
+	Target    string    `json:"target"`
+	User      string    `json:"user"` /* as authenticated to the broker */
+	LocalUser string    `json:"local_user,omitempty"`
+	RequestID string    `json:"request_id"`
+	Operation string    `json:"operation"`
+	Instance  string    `json:"instance,omitempty"`
+	Method    string    `json:"method"`
+	Route     string    `json:"route"`
+	Status    int       `json:"status,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	Elapsed   float64   `json:"elapsed"` /* seconds */
+}
+
+// AuditSink is something that keeps audit entries.
+type AuditSink interface {
+	Record(AuditEntry) error
+}
+
+type FileAudit struct {
+	Path string
+
+	lock sync.Mutex
+}
+
+func (a *FileAudit) Record(e AuditEntry) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(a.Path), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(a.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(b, '\n'))
+	return err
+}
+
+type WebhookAudit struct {
+	URL     string
+	Headers map[string]string
+	Client  *http.Client
+}
+
+func (a *WebhookAudit) Record(e AuditEntry) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", a.URL, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range a.Headers {
+		req.Header.Set(k, v)
+	}
+
+	ua := a.Client
+	if ua == nil {
+		ua = &http.Client{Timeout: 10 * time.Second}
+	}
+	res, err := ua.Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("audit webhook %s returned %s", a.URL, res.Status)
+	}
+	return nil
+}
+
+// Sinks are the places this config sends audit entries to; relative
+// file paths are taken to be under ~/.boss.
+func (a *AuditConfig) Sinks() []AuditSink {
+	l := make([]AuditSink, 0)
+	if a == nil {
+		return l
+	}
+	if a.File != "" {
+		path := a.File
+		if strings.HasPrefix(path, "~/") {
+			if home, err := os.UserHomeDir(); err == nil {
+				path = filepath.Join(home, path[2:])
+			}
+		} else if !filepath.IsAbs(path) {
+			path = bossFile(path)
+		}
+		l = append(l, &FileAudit{Path: path})
+	}
+	if a.Webhook != "" {
+		l = append(l, &WebhookAudit{URL: a.Webhook, Headers: a.Headers})
+	}
+	return l
+}
+
+// auditOperation names what a request does, in broker terms.
+func auditOperation(method, route string) string {
+	switch {
+	case strings.HasSuffix(route, "/redeploy"):
+		return "redeploy"
+	case route == "/v2/service_instances/:id":
+		switch method {
+		case "PUT":
+			return "provision"
+		case "PATCH":
+			return "update"
+		case "DELETE":
+			return "deprovision"
+		}
+	case strings.HasPrefix(route, "/v2/service_instances/:id/service_bindings/"):
+		switch method {
+		case "PUT":
+			return "bind"
+		case "DELETE":
+			return "unbind"
+		}
+	}
+	return strings.ToLower(method) + " " + route
+}
+
+/* the instance ID, for /v2/service_instances/:id/... and /b/:id/... */
+func auditInstance(path string) string {
+	l := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	switch {
+	case len(l) >= 3 && l[0] == "v2" && l[1] == "service_instances":
+		return l[2]
+	case len(l) >= 3 && l[0] == "b":
+		return l[1]
+	}
+	return ""
+}
+
+// Audit is Middleware that records every request that changes
+// something (the same ones that --dry-run holds back) to each of the
+// sinks.  Failing to record an entry doesn't fail the request; warn
+// is told about it instead.
+func Audit(target string, sinks []AuditSink, warn func(error)) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		if len(sinks) == 0 {
+			return next
+		}
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if !mutating(req.Method, req.URL.Path) {
+				return next.RoundTrip(req)
+			}
+
+			start := time.Now()
+			res, err := next.RoundTrip(req)
+
+			route := Route(req.URL.Path)
+			user, _, _ := req.BasicAuth()
+			e := AuditEntry{
+				Time:      start.UTC(),
+				Target:    target,
+				User:      user,
+				LocalUser: whoami(),
+				RequestID: req.Header.Get("X-Request-ID"),
+				Operation: auditOperation(req.Method, route),
+				Instance:  auditInstance(req.URL.Path),
+				Method:    req.Method,
+				Route:     route,
+				Elapsed:   time.Since(start).Seconds(),
+			}
+			if err != nil {
+				e.Error = err.Error()
+			} else {
+				e.Status = res.StatusCode
+			}
+
+			for _, sink := range sinks {
+				if err := sink.Record(e); err != nil && warn != nil {
+					warn(err)
+				}
+			}
+			return res, err
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+)
+
+// DumpTool is how to back up (and restore) one kind of service with
+// its own command-line tools, pointed at an instance by way of its
+// credentials.  Backups are written to standard output, and restores
+// read from standard input.
+type DumpTool struct {
+	Kind    string
+	Ext     string
+	Backup  []string
+	Restore []string
+	Env     []string
+}
+
+// DumpToolFor works out which dump tool to use for an instance, from
+// its credentials and hints (its service name and tags), if any.
+func DumpToolFor(creds string, hints ...string) (DumpTool, bool, error) {
+	v, err := parseYAML(creds)
+	if err != nil {
+		return DumpTool{}, false, err
+	}
+	e, ok := findEndpoint(v)
+	if !ok {
+		return DumpTool{}, false, fmt.Errorf("unable to determine a host and port from the instance credentials")
+	}
+
+	m := asMap(v)
+	user := credField(m, "username", "user", "login")
+	pass := credField(m, "password", "pass")
+	db := credField(m, "database", "db", "dbname")
+	host, port := e.Host, strconv.Itoa(e.Port)
+
+	switch kind := serviceScheme(e.Port, hints); kind {
+	case "postgres":
+		if db == "" {
+			db = user
+		}
+		return DumpTool{
+			Kind:    kind,
+			Ext:     "pgdump",
+			Backup:  []string{"pg_dump", "--format=custom", "--no-owner", "--no-privileges"},
+			Restore: []string{"pg_restore", "--clean", "--if-exists", "--no-owner", "--no-privileges", "--dbname", db},
+			Env: []string{
+				"PGHOST=" + host, "PGPORT=" + port, "PGUSER=" + user,
+				"PGPASSWORD=" + pass, "PGDATABASE=" + db,
+			},
+		}, true, nil
+
+	case "mysql":
+		conn := []string{"--host", host, "--port", port, "--user", user}
+		which := []string{"--all-databases"}
+		if db != "" {
+			which = []string{"--databases", db}
+		}
+		return DumpTool{
+			Kind:    kind,
+			Ext:     "sql",
+			Backup:  append(append([]string{"mysqldump", "--single-transaction", "--routines", "--triggers"}, conn...), which...),
+			Restore: append([]string{"mysql"}, conn...),
+			Env:     []string{"MYSQL_PWD=" + pass},
+		}, true, nil
+
+	case "redis":
+		/* there's no loading an RDB file back in over the wire */
+		return DumpTool{
+			Kind:   kind,
+			Ext:    "rdb",
+			Backup: []string{"redis-cli", "-h", host, "-p", port, "--rdb", "-"},
+			Env:    []string{"REDISCLI_AUTH=" + pass},
+		}, true, nil
+	}
+	return DumpTool{}, false, nil
+}
+
+// Check looks at the start of a backup to see if it is the kind this
+// tool restores from, so that (say) a SQL dump isn't fed to pg_restore.
+func (t DumpTool) Check(head []byte) error {
+	archive := bytes.HasPrefix(head, []byte("PGDMP"))
+	switch t.Kind {
+	case "postgres":
+		if !archive {
+			return fmt.Errorf("not a pg_dump archive (.%s), which is what %s instances are restored from", t.Ext, t.Kind)
+		}
+	case "mysql":
+		if archive || bytes.IndexByte(head, 0) >= 0 {
+			return fmt.Errorf("not a SQL dump (.%s), which is what %s instances are restored from", t.Ext, t.Kind)
+		}
+	}
+	return nil
+}
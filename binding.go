@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+type Binding struct {
+	Credentials     map[string]interface{} `json:"credentials"`
+	Parameters      map[string]interface{} `json:"parameters"`
+	SyslogDrainURL  string                 `json:"syslog_drain_url"`
+	RouteServiceURL string                 `json:"route_service_url"`
+}
+
+func (c *Client) GetBinding(instance, binding string) (Binding, error) {
+	var out Binding
+	if !c.Supports("2.14") {
+		return out, fmt.Errorf("broker OSB API version %s does not support binding retrieval: %w", c.apiVersion(), ErrNotSupported)
+	}
+
+	ref, err := c.instanceRef(instance)
+	if err != nil {
+		return out, err
+	}
+
+	q := NewQuery().
+		Set("service_id", ref.ServiceID).
+		Set("plan_id", ref.PlanID)
+
+	_, err = c.request("GET", q.Path("/v2/service_instances/%s/service_bindings/%s", instance, binding), nil, &out)
+	return out, err
+}
+
+type bindRequest struct {
+	ServiceID  string                 `json:"service_id"`
+	PlanID     string                 `json:"plan_id"`
+	Parameters map[string]interface{} `json:"parameters,omitempty"`
+}
+
+type asyncResponse struct {
+	Operation string `json:"operation"`
+}
+
+// Bind creates a new binding.  If the broker binds asynchronously,
+// the returned Binding will be empty; see BindAndWait.
+func (c *Client) Bind(instance, binding string, params map[string]interface{}) (Binding, error) {
+	ref, err := c.instanceRef(instance)
+	if err != nil {
+		return Binding{}, err
+	}
+	out, _, err := c.bind(instance, binding, ref, params)
+	return out, err
+}
+
+/* bind returns the operation to poll, if the broker went async */
+func (c *Client) bind(instance, binding string, ref instanceRef, params map[string]interface{}) (Binding, *string, error) {
+	in := bindRequest{
+		ServiceID:  ref.ServiceID,
+		PlanID:     ref.PlanID,
+		Parameters: params,
+	}
+
+	var raw json.RawMessage
+	q := NewQuery().Bool("accepts_incomplete", !c.Sync)
+	status, err := c.request("PUT", q.Path("/v2/service_instances/%s/service_bindings/%s", instance, binding), in, &raw)
+	if err != nil {
+		return Binding{}, nil, err
+	}
+
+	if status == 202 {
+		var async asyncResponse
+		json.Unmarshal(raw, &async)
+		return Binding{}, &async.Operation, nil
+	}
+
+	var out Binding
+	err = json.Unmarshal(raw, &out)
+	return out, nil, err
+}
+
+func (c *Client) BindAndWait(instance, binding string, params map[string]interface{}, timeout time.Duration) (Binding, error) {
+	ref, err := c.instanceRef(instance)
+	if err != nil {
+		return Binding{}, err
+	}
+
+	out, operation, err := c.bind(instance, binding, ref, params)
+	if err != nil || operation == nil || c.DryRun {
+		return out, err
+	}
+
+	_, err = c.poll(instance, ref.PlanID, "bind", false, timeout, func() (Operation, error) {
+		return c.bindingOperation(instance, binding, ref, *operation)
+	})
+	if err != nil {
+		return Binding{}, err
+	}
+
+	/* async bindings hand over their credentials afterwards */
+	return c.GetBinding(instance, binding)
+}
+
+func (c *Client) Unbind(instance, binding string) error {
+	ref, err := c.instanceRef(instance)
+	if err != nil {
+		return err
+	}
+	_, err = c.unbind(instance, binding, ref)
+	return err
+}
+
+func (c *Client) unbind(instance, binding string, ref instanceRef) (*string, error) {
+	q := NewQuery().
+		Set("service_id", ref.ServiceID).
+		Set("plan_id", ref.PlanID).
+		Bool("accepts_incomplete", !c.Sync)
+
+	var async asyncResponse
+	status, err := c.request("DELETE", q.Path("/v2/service_instances/%s/service_bindings/%s", instance, binding), nil, &async)
+	if err != nil || status != 202 {
+		return nil, err
+	}
+	return &async.Operation, nil
+}
+
+func (c *Client) UnbindAndWait(instance, binding string, timeout time.Duration) error {
+	ref, err := c.instanceRef(instance)
+	if err != nil {
+		return err
+	}
+
+	operation, err := c.unbind(instance, binding, ref)
+	if err != nil || operation == nil || c.DryRun {
+		return err
+	}
+
+	_, err = c.poll(instance, ref.PlanID, "unbind", true, timeout, func() (Operation, error) {
+		return c.bindingOperation(instance, binding, ref, *operation)
+	})
+	return err
+}
+
+func (c *Client) bindingOperation(instance, binding string, ref instanceRef, operation string) (Operation, error) {
+	var op Operation
+
+	q := NewQuery().
+		Set("service_id", ref.ServiceID).
+		Set("plan_id", ref.PlanID).
+		Set("operation", operation)
+
+	res, err := c.call("GET", q.Path("/v2/service_instances/%s/service_bindings/%s/last_operation", instance, binding), nil, &op)
+	if err == nil && res.Header.Get("Retry-After") != "" {
+		op.RetryAfter = retryAfter(res.Header.Get("Retry-After"), 0)
+	}
+	return op, err
+}
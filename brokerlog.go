@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// LogEntry is one line (and any continuation lines after it)
+// of the Blacksmith broker log.
+type LogEntry struct {
+	Time     time.Time
+	Level    string
+	Instance string
+	Message  string
+}
+
+var instancePattern = regexp.MustCompile(`[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`)
+
+/* BOSH VMs run on UTC, so timestamps without a zone are taken as UTC */
+var logTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999",
+	"2006/01/02 15:04:05.999999999",
+}
+
+func cutWord(s string) (string, string) {
+	s = strings.TrimLeft(s, " \t")
+	if i := strings.IndexAny(s, " \t"); i >= 0 {
+		return s[:i], strings.TrimLeft(s[i:], " \t")
+	}
+	return s, ""
+}
+
+func parseLogTime(s string) (time.Time, bool) {
+	for _, layout := range logTimeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// ParseLogLine picks the timestamp, level and instance out of a line
+// of the broker log.  Lines that don't start with a timestamp continue
+// the entry before them, and are reported as not ok.
+func ParseLogLine(line string) (LogEntry, bool) {
+	e := LogEntry{Message: line}
+
+	date, rest := cutWord(line)
+	clock, more := cutWord(rest)
+	if t, ok := parseLogTime(date + " " + clock); ok {
+		e.Time, rest = t, more
+	} else if t, ok := parseLogTime(date); ok {
+		e.Time = t
+	} else {
+		return e, false
+	}
+
+	word, more := cutWord(rest)
+	level := strings.ToLower(strings.Trim(word, "[]<>:"))
+	if level == "warning" {
+		level = "warn"
+	}
+	if _, err := ParseLogLevel(level); err == nil {
+		e.Level, rest = level, more
+	}
+
+	e.Instance = instancePattern.FindString(rest)
+	e.Message = rest
+	return e, true
+}
+
+type LogFilter struct {
+	Instance string
+	Level    string
+	Since    time.Time
+}
+
+func (f LogFilter) Match(e LogEntry) bool {
+	if f.Instance != "" && e.Instance != f.Instance && !strings.Contains(e.Message, f.Instance) {
+		return false
+	}
+	if f.Level != "" {
+		want, _ := ParseLogLevel(f.Level)
+		have, err := ParseLogLevel(e.Level)
+		if err != nil || have > want {
+			return false
+		}
+	}
+	if !f.Since.IsZero() && e.Time.Before(f.Since) {
+		return false
+	}
+	return true
+}
+
+// LogWriter passes through only the broker log entries that match its
+// filter.  Continuation lines go wherever the line before them went.
+// With JSON set, each entry is written as a line of JSON instead.
+type LogWriter struct {
+	Out    io.Writer
+	Filter LogFilter
+	JSON   bool
+
+	buf     string
+	keep    bool
+	started bool
+	pending *LogEntry
+}
+
+func (w *LogWriter) Write(b []byte) (int, error) {
+	w.buf += string(b)
+	for {
+		i := strings.IndexByte(w.buf, '\n')
+		if i < 0 {
+			return len(b), nil
+		}
+		line := w.buf[:i]
+		w.buf = w.buf[i+1:]
+		if err := w.line(line); err != nil {
+			return len(b), err
+		}
+	}
+}
+
+// Flush handles a final, unterminated line, and
+// any JSON entry still waiting on continuation lines.
+func (w *LogWriter) Flush() error {
+	if w.buf != "" {
+		line := w.buf
+		w.buf = ""
+		if err := w.line(line); err != nil {
+			return err
+		}
+	}
+	return w.emit()
+}
+
+func (w *LogWriter) line(s string) error {
+	e, ok := ParseLogLine(s)
+	if ok || !w.started {
+		if err := w.emit(); err != nil {
+			return err
+		}
+		w.keep = w.Filter.Match(e)
+		w.started = true
+		if w.JSON {
+			w.pending = &e
+			return nil
+		}
+	} else if w.JSON && w.pending != nil {
+		w.pending.Message += "\n" + s
+		return nil
+	}
+
+	if !w.keep || w.JSON {
+		return nil
+	}
+	_, err := io.WriteString(w.Out, s+"\n")
+	return err
+}
+
+func (w *LogWriter) emit() error {
+	e := w.pending
+	w.pending = nil
+	if e == nil || !w.keep {
+		return nil
+	}
+
+	b, err := json.Marshal(logEntryV1(*e))
+	if err != nil {
+		return err
+	}
+	_, err = w.Out.Write(append(b, '\n'))
+	return err
+}
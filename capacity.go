@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// VMs estimates how many BOSH VMs each instance of the plan deploys,
+// from its metadata (vms, instances or nodes), assuming just the one
+// if the plan doesn't say.
+func (p Plan) VMs() int {
+	if n := p.metaInt("vms", "instances", "nodes"); n > 0 {
+		return n
+	}
+	return 1
+}
+
+// DiskMB is the size of the persistent disk on each of the plan's VMs,
+// in megabytes, from its metadata (i.e. disk: 10G, or disk: 10240), or
+// 0 if the plan doesn't say.
+func (p Plan) DiskMB() int {
+	for _, k := range []string{"disk", "persistent_disk", "disk_size"} {
+		if n := p.metaInt(k); n > 0 {
+			return n
+		}
+		if s, ok := p.Metadata[k].(string); ok {
+			if mb, ok := parseMB(s); ok {
+				return mb
+			}
+		}
+	}
+	return 0
+}
+
+/* bare numbers are megabytes, like BOSH disk sizes */
+func parseMB(s string) (int, bool) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "B"), "I")
+
+	mult := 1.0
+	switch {
+	case strings.HasSuffix(s, "T"):
+		mult = 1024 * 1024
+	case strings.HasSuffix(s, "G"):
+		mult = 1024
+	}
+	f, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimRight(s, "TGM")), 64)
+	if err != nil || f < 0 {
+		return 0, false
+	}
+	return int(f * mult), true
+}
+
+func humanMB(mb int) string {
+	switch {
+	case mb <= 0:
+		return "-"
+	case mb >= 1024*1024:
+		return strings.TrimSuffix(fmt.Sprintf("%.1f", float64(mb)/(1024*1024)), ".0") + "T"
+	case mb >= 1024:
+		return strings.TrimSuffix(fmt.Sprintf("%.1f", float64(mb)/1024), ".0") + "G"
+	}
+	return fmt.Sprintf("%dM", mb)
+}
+
+// Capacity is one plan's share of the broker's IaaS footprint, as
+// estimated from the plan metadata.
+type Capacity struct {
+	Quota
+	VMs    int /* per instance */
+	DiskMB int /* per VM */
+}
+
+func (c Capacity) TotalVMs() int {
+	return c.Used * c.VMs
+}
+
+func (c Capacity) TotalDiskMB() int {
+	return c.TotalVMs() * c.DiskMB
+}
+
+// Capacity estimates the footprint of every plan in the catalog.
+func (c *Client) Capacity() ([]Capacity, error) {
+	quotas, err := c.Quotas()
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]Capacity, 0, len(quotas))
+	for _, q := range quotas {
+		out = append(out, Capacity{
+			Quota:  q,
+			VMs:    q.Plan.VMs(),
+			DiskMB: q.Plan.DiskMB(),
+		})
+	}
+	return out, nil
+}
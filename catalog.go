@@ -0,0 +1,140 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+type Catalog struct {
+	Services []Service `json:"services"`
+
+	// IgnoreCase makes service and plan name lookups case-insensitive.
+	// Exact matches are still preferred.
+	IgnoreCase bool `json:"-"`
+}
+
+func (c Catalog) matches(a, b string) bool {
+	if c.IgnoreCase {
+		return strings.EqualFold(a, b)
+	}
+	return a == b
+}
+
+func (c Catalog) ServiceByID(id string) (*Service, error) {
+	for i := range c.Services {
+		if c.Services[i].ID == id {
+			return &c.Services[i], nil
+		}
+	}
+	return nil, ServiceNotFoundError{Service: id}
+}
+
+func (c Catalog) ServiceByName(name string) (*Service, error) {
+	for i := range c.Services {
+		if c.Services[i].Name == name {
+			return &c.Services[i], nil
+		}
+	}
+	for i := range c.Services {
+		if c.matches(c.Services[i].Name, name) {
+			return &c.Services[i], nil
+		}
+	}
+
+	names := make([]string, len(c.Services))
+	for i := range c.Services {
+		names[i] = c.Services[i].Name
+	}
+	i, ambiguous, ok := byPrefix(name, names, c.IgnoreCase)
+	if ok {
+		return &c.Services[i], nil
+	}
+	if len(ambiguous) == 0 {
+		ambiguous = suggest(name, names, false)
+	}
+	return nil, ServiceNotFoundError{Service: name, Suggestions: ambiguous}
+}
+
+// PlanByID finds a plan (and its service) by plan ID alone;
+// the OSB spec requires plan IDs to be globally unique.
+func (c Catalog) PlanByID(id string) (*Service, *Plan, error) {
+	for i := range c.Services {
+		s := &c.Services[i]
+		for j := range s.Plans {
+			if s.Plans[j].ID == id {
+				return s, &s.Plans[j], nil
+			}
+		}
+	}
+	return nil, nil, PlanNotFoundError{Plan: id}
+}
+
+func (c Catalog) PlanByName(service *Service, name string) (*Plan, error) {
+	for i := range service.Plans {
+		if service.Plans[i].Name == name {
+			return &service.Plans[i], nil
+		}
+	}
+	for i := range service.Plans {
+		if c.matches(service.Plans[i].Name, name) {
+			return &service.Plans[i], nil
+		}
+	}
+
+	names := make([]string, len(service.Plans))
+	for i := range service.Plans {
+		names[i] = service.Plans[i].Name
+	}
+	i, ambiguous, ok := byPrefix(name, names, c.IgnoreCase)
+	if ok {
+		return &service.Plans[i], nil
+	}
+	if len(ambiguous) == 0 {
+		ambiguous = suggest(name, names, false)
+	}
+	return nil, PlanNotFoundError{Service: service.Name, Plan: name, Suggestions: ambiguous}
+}
+
+// Plan resolves a service and plan, each given either by ID or by name.
+func (c Catalog) Plan(service, plan string) (*Service, *Plan, error) {
+	s, err := c.ServiceByID(service)
+	if err != nil {
+		s, err = c.ServiceByName(service)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	for i := range s.Plans {
+		if s.Plans[i].ID == plan {
+			return s, &s.Plans[i], nil
+		}
+	}
+	p, err := c.PlanByName(s, plan)
+	if err != nil {
+		return nil, nil, err
+	}
+	return s, p, nil
+}
+
+// MustResolvePlan is like Plan, but panics if the plan cannot be found.
+func (c Catalog) MustResolvePlan(service, plan string) (*Service, *Plan) {
+	s, p, err := c.Plan(service, plan)
+	if err != nil {
+		panic(err)
+	}
+	return s, p
+}
+
+// sort orders services and plans by name; brokers are free to
+// reorder the catalog from one request to the next.
+func (c Catalog) sort() {
+	sort.SliceStable(c.Services, func(i, j int) bool {
+		return c.Services[i].Name < c.Services[j].Name
+	})
+	for _, s := range c.Services {
+		sort.SliceStable(s.Plans, func(i, j int) bool {
+			return s.Plans[i].Name < s.Plans[j].Name
+		})
+	}
+}
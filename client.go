@@ -2,15 +2,26 @@ package main
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
 	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"net/http/httputil"
-	"os"
+	"net/url"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
 type Client struct {
@@ -18,168 +29,462 @@ type Client struct {
 	Username           string
 	Password           string
 	InsecureSkipVerify bool
+	RootCAs            *x509.CertPool
 	Debug              bool
 	Trace              bool
+	TraceUnsafe        bool
+	Logger             *Logger
+	Sync               bool
+	MaxIdleConns       int
+	MaxRetries         int
+	Timeout            time.Duration
+	IdleTimeout        time.Duration
+	PollInterval       time.Duration
+	MaxPollInterval    time.Duration
+	Durations          DurationStore
+	NoCompression      bool
+	APIVersion         string
+	IgnoreCase         bool
+	Aliases            map[string]string
+	DryRun             bool
+	SkipManifestCheck  bool
+	DryRunOut          io.Writer
+	Capabilities       *Capabilities
+	CatalogCheck       func(Catalog) error
+	ConfirmSuffix      func(want, id string) bool
+	Middleware         []Middleware
+	Metrics            Metrics
+	Tracer             Tracer
+	Progress           Progress
+	Context            context.Context
 
-	ua *http.Client
+	once sync.Once
+	lock sync.Mutex
+	ping sync.Mutex
+	ua   *http.Client
+	base string
 }
 
 type Plan struct {
-	ID          string `json:"id"`
-	Name        string `json:"name"`
-	Description string `json:"description/"`
+	ID              string                 `json:"id"`
+	Name            string                 `json:"name"`
+	Description     string                 `json:"description"`
+	Free            *bool                  `json:"free,omitempty"`
+	Bindable        *bool                  `json:"bindable,omitempty"`
+	PlanUpdateable  *bool                  `json:"plan_updateable,omitempty"`
+	Metadata        map[string]interface{} `json:"metadata,omitempty"`
+	MaintenanceInfo *MaintenanceInfo       `json:"maintenance_info,omitempty"`
+	Schemas         *Schemas               `json:"schemas,omitempty"`
+}
+
+// Outdated reports whether an instance at the given maintenance
+// version could be upgraded to what the plan currently offers.
+func (p Plan) Outdated(current *MaintenanceInfo) bool {
+	if p.MaintenanceInfo == nil || p.MaintenanceInfo.Version == "" {
+		return false
+	}
+	return current == nil || current.Version != p.MaintenanceInfo.Version
 }
 
 type Service struct {
-	ID             string   `json:"id"`
-	Name           string   `json:"name"`
-	Description    string   `json:"description/"`
-	Bindable       bool     `json:"bindable"`
-	Tags           []string `json:"tags"`
-	PlanUpdateable bool     `json:"plan_updateable"`
-	Plans          []Plan   `json:"plans"`
-}
-
-type Catalog struct {
-	Services []Service `json:"services"`
-}
-
-func (c Catalog) Plan(service, plan string) (*Service, *Plan, error) {
-	for _, s := range c.Services {
-		if s.ID == service {
-			for _, p := range s.Plans {
-				if p.ID == plan {
-					return &s, &p, nil
-				}
-			}
-		}
+	ID                   string   `json:"id"`
+	Name                 string   `json:"name"`
+	Description          string   `json:"description"`
+	Bindable             bool     `json:"bindable"`
+	InstancesRetrievable bool     `json:"instances_retrievable"`
+	BindingsRetrievable  bool     `json:"bindings_retrievable"`
+	Tags                 []string `json:"tags"`
+	PlanUpdateable       bool     `json:"plan_updateable"`
+	Plans                []Plan   `json:"plans"`
+}
+
+type Instance struct {
+	ID           string    `json:"id"`
+	Name         string    `json:"name,omitempty"`
+	Service      *Service  `json:"service"`
+	Plan         *Plan     `json:"plan"`
+	DashboardURL string    `json:"dashboard_url,omitempty"`
+	Created      time.Time `json:"-"` /* if the broker says */
+}
+
+type MaintenanceInfo struct {
+	Version     string `json:"version"`
+	Description string `json:"description"`
+}
+
+type InstanceDetails struct {
+	ServiceID       string                 `json:"service_id"`
+	PlanID          string                 `json:"plan_id"`
+	DashboardURL    string                 `json:"dashboard_url"`
+	Parameters      map[string]interface{} `json:"parameters"`
+	MaintenanceInfo *MaintenanceInfo       `json:"maintenance_info"`
+}
+
+type Query struct {
+	values url.Values
+}
+
+func NewQuery() *Query {
+	return &Query{values: url.Values{}}
+}
+
+func (q *Query) Set(key, value string) *Query {
+	if value != "" {
+		q.values.Set(key, value)
 	}
-	for _, s := range c.Services {
-		if s.Name == service {
-			for _, p := range s.Plans {
-				if p.Name == plan {
-					return &s, &p, nil
-				}
-			}
-		}
+	return q
+}
+
+func (q *Query) Bool(key string, value bool) *Query {
+	if value {
+		q.values.Set(key, "true")
 	}
+	return q
+}
 
-	return nil, nil, fmt.Errorf("service '%s' / plan '%s' not found", service, plan)
+func (q *Query) Path(path string, args ...interface{}) string {
+	path = fmt.Sprintf(path, args...)
+	if q == nil || len(q.values) == 0 {
+		return path
+	}
+	return path + "?" + q.values.Encode()
 }
 
-type Instance struct {
-	ID      string   `json:"id"`
-	Service *Service `json:"service"`
-	Plan    *Plan    `json:"plan"`
+func (c *Client) init() {
+	c.once.Do(c.setup)
 }
 
-func (c Client) do(method, path string, in interface{}) (*http.Response, error) {
-	if c.ua == nil {
-		c.ua = &http.Client{
-			Transport: &http.Transport{
-				TLSClientConfig: &tls.Config{
-					InsecureSkipVerify: c.InsecureSkipVerify,
-				},
-				Proxy: http.ProxyFromEnvironment,
-			},
+func (c *Client) setup() {
+	idle := c.MaxIdleConns
+	if idle <= 0 {
+		idle = 10
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	dial := dialer.DialContext
+	proxy := http.ProxyFromEnvironment
+
+	c.base = strings.TrimSuffix(c.URL, "/")
+	if strings.HasPrefix(c.URL, "unix://") {
+		/* talk HTTP over a local socket, i.e. on the Blacksmith VM */
+		socket := strings.TrimPrefix(c.URL, "unix://")
+		dial = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "unix", socket)
 		}
-		c.URL = strings.TrimSuffix(c.URL, "/")
+		proxy = nil
+		c.base = "http://localhost"
 	}
 
-	var body io.Reader = nil
+	transport := &http.Transport{
+		TLSClientConfig: &tls.Config{
+			InsecureSkipVerify: c.InsecureSkipVerify,
+			RootCAs:            c.RootCAs,
+		},
+		Proxy:               proxy,
+		DialContext:         dial,
+		ForceAttemptHTTP2:   true,
+		DisableCompression:  true,
+		MaxIdleConns:        idle,
+		MaxIdleConnsPerHost: idle,
+		IdleConnTimeout:     90 * time.Second,
+		TLSHandshakeTimeout: 10 * time.Second,
+	}
+
+	/* no overall timeout: streams (--follow) and synchronous (--sync)
+	   provisions can take as long as they take; only Ping is hurried */
+	c.ua = &http.Client{
+		Transport: c.wrap(transport),
+	}
+
+	if c.Logger == nil {
+		level := LogWarn
+		if c.Trace {
+			level = LogTrace
+		} else if c.Debug {
+			level = LogDebug
+		}
+		c.Logger = NewLogger(level)
+	}
+}
+
+func (c *Client) do(method, path string, in interface{}) (*http.Response, error) {
+	c.init()
+	return c.exec(c.ua, "", method, path, in)
+}
+
+func (c *Client) exec(ua *http.Client, version, method, path string, in interface{}) (res *http.Response, err error) {
+	negotiable := version == "" && c.APIVersion == ""
+	if version == "" {
+		version = c.apiVersion()
+	}
+
+	var payload []byte
 	if in != nil {
 		b, err := json.Marshal(in)
 		if err != nil {
 			return nil, err
 		}
 
-		body = bytes.NewBuffer(b)
+		payload = b
+	}
+
+	retries := c.MaxRetries
+	if retries <= 0 {
+		retries = 3
+	}
+
+	if c.DryRun && mutating(method, path) {
+		return c.dryRun(version, method, path, payload), nil
+	}
+
+	rid := requestID()
+	ctx, span := c.startSpan(method, path, rid)
+	tries := 0
+	defer func() { endSpan(span, res, err, tries) }()
+
+	for attempt := 0; ; attempt++ {
+		res, err := c.send(ctx, ua, version, method, path, rid, payload)
+		if err != nil {
+			return nil, err
+		}
+
+		if res.StatusCode == 412 && negotiable {
+			/* the broker doesn't like our API version; find one it does */
+			c.retried(method, path, "version")
+			tries++
+			io.Copy(ioutil.Discard, res.Body)
+			res.Body.Close()
+			caps, err := c.Ping()
+			if err != nil {
+				return nil, err
+			}
+			/* and go around again, so that a 429 still gets waited out */
+			version, negotiable = caps.APIVersion, false
+			continue
+		}
+
+		if res.StatusCode != 429 || attempt >= retries {
+			return res, nil
+		}
+
+		c.retried(method, path, "rate_limited")
+		tries++
+		wait := retryAfter(res.Header.Get("Retry-After"), attempt)
+		c.Logger.Warnf("rate-limited by broker", "retry_in", wait, "attempt", attempt+1, "retries", retries, "request_id", rid)
+
+		io.Copy(ioutil.Discard, res.Body)
+		res.Body.Close()
+		time.Sleep(wait)
 	}
+}
 
-	req, err := http.NewRequest(method, c.URL+path, body)
+func (c *Client) send(ctx context.Context, ua *http.Client, version, method, path, rid string, payload []byte) (*http.Response, error) {
+	var body io.Reader = nil
+	if payload != nil {
+		body = bytes.NewBuffer(payload)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.base+path, body)
 	if err != nil {
 		return nil, err
 	}
 
-	req.Header.Set("X-Broker-API-Version", "2.14")
+	req.Header.Set("X-Broker-API-Version", version)
+	req.Header.Set("X-Request-ID", rid)
+	if !c.NoCompression {
+		req.Header.Set("Accept-Encoding", "gzip")
+	}
 	req.SetBasicAuth(c.Username, c.Password)
 
-	if c.Trace {
+	c.Logger.Debugf("request", "method", method, "url", c.redactURL(c.base+path), "request_id", rid)
+
+	if c.Logger.Enabled(LogTrace) {
 		b, err := httputil.DumpRequestOut(req, true)
 		if err == nil {
-			fmt.Fprintf(os.Stderr, "=================================\n")
-			fmt.Fprintf(os.Stderr, "%s\n\n", string(b))
+			if !c.TraceUnsafe {
+				b = redact(b)
+			}
+			c.Logger.Dump("request", b)
 		}
 	}
 
-	res, err := c.ua.Do(req)
+	start := time.Now()
+	res, err := ua.Do(req)
 	if err != nil {
+		c.observe(method, path, 0, err, time.Since(start))
 		return nil, err
 	}
+	c.observe(method, path, res.StatusCode, nil, time.Since(start))
+
+	c.Logger.Debugf("response", "status", res.Status, "request_id", rid)
+
+	if res.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(res.Body)
+		if err != nil {
+			res.Body.Close()
+			return nil, err
+		}
+
+		c.Logger.Debugf("decompressing gzip response", "compressed_bytes", res.ContentLength, "request_id", rid)
+		res.Body = gzipBody{Reader: gz, body: res.Body}
+		res.Header.Del("Content-Encoding")
+		res.Header.Del("Content-Length")
+		res.ContentLength = -1
+		res.Uncompressed = true
+	}
 
-	if c.Trace {
+	if c.Logger.Enabled(LogTrace) {
 		b, err := httputil.DumpResponse(res, true)
 		if err == nil {
-			fmt.Fprintf(os.Stderr, "=================================\n")
-			fmt.Fprintf(os.Stderr, "%s\n\n", string(b))
+			if !c.TraceUnsafe {
+				b = redact(b)
+			}
+			c.Logger.Dump("response", b)
 		}
 	}
 
 	return res, nil
 }
 
-func (c Client) request(method, path string, in, out interface{}) (int, error) {
+type gzipBody struct {
+	*gzip.Reader
+	body io.ReadCloser
+}
+
+func (g gzipBody) Close() error {
+	g.Reader.Close()
+	return g.body.Close()
+}
+
+func (c *Client) redactURL(s string) string {
+	if c.TraceUnsafe {
+		return s
+	}
+	return string(redact([]byte(s)))
+}
+
+func retryAfter(header string, attempt int) time.Duration {
+	wait := time.Duration(1<<uint(attempt)) * time.Second
+	if header != "" {
+		if n, err := strconv.Atoi(header); err == nil {
+			wait = time.Duration(n) * time.Second
+		} else if t, err := http.ParseTime(header); err == nil {
+			wait = time.Until(t)
+		}
+	}
+
+	if wait < 0 {
+		wait = 0
+	}
+	if wait > 60*time.Second {
+		wait = 60 * time.Second
+	}
+	return wait
+}
+
+func requestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+func (c *Client) request(method, path string, in, out interface{}) (int, error) {
+	res, err := c.call(method, path, in, out)
+	if res == nil {
+		return 0, err
+	}
+	return res.StatusCode, err
+}
+
+// call is request, for callers that need the response headers;
+// the body has already been consumed and closed.
+func (c *Client) call(method, path string, in, out interface{}) (*http.Response, error) {
 	res, err := c.do(method, path, in)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 
 	defer res.Body.Close()
-	if out != nil {
-		b, err := ioutil.ReadAll(res.Body)
-		if err != nil {
-			return 0, err
-		}
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if method == "DELETE" && res.StatusCode == 410 {
+		/* this is okay */
+		return res, nil
+	}
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res, apiError(res, b)
+	}
 
+	if out != nil {
 		err = json.Unmarshal(b, &out)
 		if err != nil {
-			return 0, err
+			return nil, err
 		}
 	}
 
-	if method == "DELETE" && res.StatusCode == 410 {
-		/* this is okay */
-		return res.StatusCode, nil
+	return res, nil
+}
+
+// Raw sends an arbitrary request to the broker, with the usual
+// authentication, TLS and retry handling, and hands back the response
+// as-is.  The body, if any, must be JSON.  The caller must close the
+// response body.
+func (c *Client) Raw(method, path string, body []byte) (*http.Response, error) {
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
 	}
 
-	if res.StatusCode < 200 || res.StatusCode > 299 {
-		return res.StatusCode, fmt.Errorf("API %s", res.Status)
+	var in interface{}
+	if len(body) > 0 {
+		if !json.Valid(body) {
+			return nil, fmt.Errorf("request body is not valid JSON")
+		}
+		in = json.RawMessage(body)
 	}
+	return c.do(strings.ToUpper(method), path, in)
+}
 
-	return res.StatusCode, nil
+func (c *Client) text(path string, args ...interface{}) (string, error) {
+	return c.textFrom(c.do("GET", fmt.Sprintf(path, args...), nil))
 }
 
-func (c Client) text(path string, args ...interface{}) (string, error) {
-	res, err := c.do("GET", fmt.Sprintf(path, args...), nil)
+func (c *Client) textFrom(res *http.Response, err error) (string, error) {
 	if err != nil {
 		return "", err
 	}
 	defer res.Body.Close()
 
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", err
+	}
 	if res.StatusCode != 200 {
-		return "", fmt.Errorf("API %s", res.Status)
+		return "", apiError(res, b)
 	}
-	b, err := ioutil.ReadAll(res.Body)
-	return string(b), err
+	return string(b), nil
 }
 
-func (c Client) Catalog() (Catalog, error) {
+func (c *Client) Catalog() (Catalog, error) {
 	var out Catalog
 	_, err := c.request("GET", "/v2/catalog", nil, &out)
+	out.IgnoreCase = c.IgnoreCase
+	out.sort()
+	if err == nil && c.CatalogCheck != nil {
+		err = c.CatalogCheck(out)
+	}
 	return out, err
 }
 
-func (c Client) Plan(service, plan string) (*Service, *Plan, error) {
+func (c *Client) Plan(service, plan string) (*Service, *Plan, error) {
 	cat, err := c.Catalog()
 	if err != nil {
 		return nil, nil, err
@@ -188,116 +493,808 @@ func (c Client) Plan(service, plan string) (*Service, *Plan, error) {
 	return cat.Plan(service, plan)
 }
 
-func (c Client) Resolve(want string) (string, error) {
-	var out struct {
-		Instances map[string]struct{} `json:"instances"`
+type status struct {
+	Log       string `json:"log"`
+	Instances map[string]struct {
+		PlanID       string    `json:"plan_id"`
+		ServiceID    string    `json:"service_id"`
+		DashboardURL string    `json:"dashboard_url"`
+		CreatedAt    createdAt `json:"created_at,omitempty"`
+		Context      struct {
+			Name string `json:"instance_name"`
+		} `json:"context"`
+	} `json:"instances"`
+}
+
+// createdAt sorts by when an instance was created, whether the broker
+// gives that as a timestamp string or as seconds since the epoch.
+type createdAt string
+
+func (t *createdAt) UnmarshalJSON(b []byte) error {
+	if string(b) == "null" {
+		return nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(b, &n); err == nil {
+		f, _ := n.Float64()
+		*t = createdAt(fmt.Sprintf("%020.3f", f))
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	*t = createdAt(s)
+	return nil
+}
+
+// Time is when the instance was created, if the broker said.
+func (t createdAt) Time() (time.Time, bool) {
+	if t == "" {
+		return time.Time{}, false
+	}
+	if f, err := strconv.ParseFloat(string(t), 64); err == nil {
+		return time.Unix(int64(f), 0), true
+	}
+	if at, err := time.Parse(time.RFC3339, string(t)); err == nil {
+		return at, true
 	}
+	return time.Time{}, false
+}
+
+func (c *Client) status() (status, error) {
+	var out status
 	_, err := c.request("GET", "/b/status", nil, &out)
+	return out, err
+}
+
+func (c *Client) Exists(id string) (bool, error) {
+	out, err := c.status()
+	if err != nil {
+		return false, err
+	}
+
+	_, ok := out.Instances[id]
+	return ok, nil
+}
+
+// Resolve finds the instance a user meant: by alias, by exact ID, by
+// BOSH deployment name (PLAN-ID-INSTANCE-ID), by the name it was
+// created with, by a unique-enough prefix of its ID, by the last
+// minSuffix or more characters of its ID, or as SERVICE/N, the Nth
+// (from 0) instance of that service, oldest first.  A suffix is only
+// taken if ConfirmSuffix (when set) agrees to it.  If there's no such
+// thing, the error suggests the closest IDs, names and aliases there are.
+func (c *Client) Resolve(want string) (string, error) {
+	if id, ok := c.Aliases[want]; ok {
+		want = id
+	}
+
+	out, err := c.status()
 	if err != nil {
 		return "", err
 	}
 
-	for id := range out.Instances {
-		if id == want {
+	for id, inst := range out.Instances {
+		if id == want || inst.PlanID+"-"+id == want {
 			return id, nil
 		}
 	}
+	if named := out.named(want); len(named) == 1 {
+		return named[0], nil
+	} else if len(named) > 1 {
+		return "", fmt.Errorf("more than one instance is named `%s' (%s); use an ID instead", want, strings.Join(named, ", "))
+	}
+	prefixed := make([]string, 0)
 	for id := range out.Instances {
 		if strings.HasPrefix(id, want) {
+			prefixed = append(prefixed, id)
+		}
+	}
+	if len(prefixed) == 1 {
+		return prefixed[0], nil
+	} else if len(prefixed) > 1 {
+		sort.Strings(prefixed)
+		return "", fmt.Errorf("more than one instance ID starts with `%s' (%s); use more of the ID", want, strings.Join(prefixed, ", "))
+	}
+
+	for id := range out.Instances {
+		if strings.HasSuffix(want, "-"+id) {
 			return id, nil
 		}
 	}
+	suffixed := make([]string, 0)
+	for id := range out.Instances {
+		if len(want) >= minSuffix && strings.HasSuffix(id, want) {
+			suffixed = append(suffixed, id)
+		}
+	}
+	if len(suffixed) == 1 {
+		if c.ConfirmSuffix != nil && !c.ConfirmSuffix(want, suffixed[0]) {
+			return "", fmt.Errorf("`%s' is only the end of instance %s's ID; use the whole ID", want, suffixed[0])
+		}
+		return suffixed[0], nil
+	}
 
-	return "", fmt.Errorf("No instance found matching `%s'", want)
-}
+	if l := strings.SplitN(want, "/", 2); len(l) == 2 {
+		if n, err := strconv.Atoi(l[1]); err == nil && n >= 0 {
+			return c.resolveOrdinal(out, l[0], n)
+		}
+	}
 
-func (c Client) Log() (string, error) {
-	var out struct {
-		Log string `json:"log"`
+	aliases := make([]string, 0, len(c.Aliases))
+	for alias := range c.Aliases {
+		aliases = append(aliases, alias)
 	}
-	_, err := c.request("GET", "/b/status", nil, &out)
-	return out.Log, err
+	ids := make([]string, 0, len(out.Instances))
+	for id, inst := range out.Instances {
+		ids = append(ids, id)
+		if inst.Context.Name != "" {
+			aliases = append(aliases, inst.Context.Name)
+		}
+	}
+	l := append(suggest(want, aliases, false), suggest(want, ids, true)...)
+	if len(l) > 3 {
+		l = l[:3]
+	}
+	return "", InstanceNotFoundError{ID: want, Suggestions: l}
 }
 
-func (c Client) Instances() ([]Instance, error) {
+/* the shortest end of an ID that Resolve will go by */
+const minSuffix = 6
+
+// resolveOrdinal counts instances of a service, oldest first; those
+// of unknown age come last, by ID.
+func (c *Client) resolveOrdinal(out status, service string, n int) (string, error) {
 	cat, err := c.Catalog()
 	if err != nil {
-		return nil, err
+		return "", err
+	}
+	s, err := cat.ServiceByID(service)
+	if err != nil {
+		if s, err = cat.ServiceByName(service); err != nil {
+			return "", err
+		}
 	}
 
-	var out struct {
-		Instances map[string]struct {
-			PlanID    string `json:"plan_id"`
-			ServiceID string `json:"service_id"`
-		} `json:"instances"`
+	ids := make([]string, 0)
+	for id, inst := range out.Instances {
+		if inst.ServiceID == s.ID {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		a, b := out.Instances[ids[i]].CreatedAt, out.Instances[ids[j]].CreatedAt
+		if (a == "") != (b == "") {
+			return b == ""
+		}
+		if a != b {
+			return a < b
+		}
+		return ids[i] < ids[j]
+	})
+
+	if n >= len(ids) {
+		return "", InstanceNotFoundError{ID: fmt.Sprintf("%s/%d", service, n)}
 	}
-	_, err = c.request("GET", "/b/status", nil, &out)
+	return ids[n], nil
+}
+
+/* names live in the context an instance was provisioned with */
+func (s status) named(name string) []string {
+	ids := make([]string, 0)
+	for id, inst := range s.Instances {
+		if name != "" && inst.Context.Name == name {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Named returns the IDs of all instances given the name, via
+// create --name.
+func (c *Client) Named(name string) ([]string, error) {
+	out, err := c.status()
+	if err != nil {
+		return nil, err
+	}
+	return out.named(name), nil
+}
+
+func (c *Client) Log() (string, error) {
+	out, err := c.status()
+	return out.Log, err
+}
+
+// Instances lists all deployed service instances.  If the catalog cannot
+// be retrieved, the instances are still returned (with only the raw
+// service and plan IDs filled in), alongside a CatalogUnavailableError.
+func (c *Client) Instances() ([]Instance, error) {
+	cat, caterr := c.Catalog()
+
+	out, err := c.status()
 	if err != nil {
 		return nil, err
 	}
 
 	instances := make([]Instance, 0)
 	for id, stuff := range out.Instances {
+		created, _ := stuff.CreatedAt.Time()
+		if caterr != nil {
+			instances = append(instances, Instance{
+				ID:           id,
+				Name:         stuff.Context.Name,
+				Service:      &Service{ID: stuff.ServiceID},
+				Plan:         &Plan{ID: stuff.PlanID},
+				DashboardURL: stuff.DashboardURL,
+				Created:      created,
+			})
+			continue
+		}
+
 		service, plan, _ := cat.Plan(stuff.ServiceID, stuff.PlanID)
 		if service != nil && plan != nil {
 			instances = append(instances, Instance{
-				ID:      id,
-				Service: service,
-				Plan:    plan,
+				ID:           id,
+				Name:         stuff.Context.Name,
+				Service:      service,
+				Plan:         plan,
+				DashboardURL: stuff.DashboardURL,
+				Created:      created,
 			})
 		} else {
-			instances = append(instances, Instance{ID: id})
+			instances = append(instances, Instance{ID: id, Name: stuff.Context.Name, DashboardURL: stuff.DashboardURL, Created: created})
 		}
 	}
+	sort.Slice(instances, func(i, j int) bool {
+		return instances[i].ID < instances[j].ID
+	})
 
+	if caterr != nil {
+		return instances, CatalogUnavailableError{Err: caterr}
+	}
 	return instances, nil
 }
 
-func (c Client) Create(id, service, plan string) (Instance, error) {
+func (c *Client) GetInstance(id string) (InstanceDetails, error) {
+	var out InstanceDetails
+	if !c.Supports("2.14") {
+		return out, fmt.Errorf("broker OSB API version %s does not support instance retrieval: %w", c.apiVersion(), ErrNotSupported)
+	}
+
+	_, err := c.request("GET", "/v2/service_instances/"+id, nil, &out)
+	return out, err
+}
+
+// DescribeInstance fetches an instance from the broker when it supports
+// instance retrieval, and falls back to what /b/status knows otherwise.
+func (c *Client) DescribeInstance(id string) (InstanceDetails, error) {
+	out, err := c.GetInstance(id)
+	var e APIError
+	if err == nil || !(errors.Is(err, ErrNotSupported) || errors.As(err, &e) && (e.StatusCode == 405 || e.StatusCode == 501)) {
+		return out, err
+	}
+
+	c.Logger.Debugf("instance retrieval not supported; falling back to /b/status", "instance", id, "error", err)
+	ref, err := c.instanceRef(id)
+	if err != nil {
+		return InstanceDetails{}, err
+	}
+	return InstanceDetails{ServiceID: ref.ServiceID, PlanID: ref.PlanID}, nil
+}
+
+// ProvisionOptions carry the optional parts of create and update
+// requests.  The organization and space default to "boss".
+type ProvisionOptions struct {
+	OrgID      string
+	SpaceID    string
+	Context    map[string]interface{}
+	Parameters map[string]interface{}
+	PlanID     string /* for updates that change plans */
+}
+
+func (o ProvisionOptions) org() string {
+	if o.OrgID == "" {
+		return "boss"
+	}
+	return o.OrgID
+}
+
+func (o ProvisionOptions) space() string {
+	if o.SpaceID == "" {
+		return "boss"
+	}
+	return o.SpaceID
+}
+
+/* the OSB context object, which supersedes the top-level org / space */
+func (o ProvisionOptions) context() map[string]interface{} {
+	ctx := map[string]interface{}{
+		"platform":          "boss",
+		"organization_guid": o.org(),
+		"space_guid":        o.space(),
+	}
+	for k, v := range o.Context {
+		ctx[k] = v
+	}
+	return ctx
+}
+
+// Params retrieves the parameters an instance was provisioned (or last
+// updated) with, via instance retrieval when the broker supports it,
+// and from Blacksmith's own records of the instance otherwise.
+func (c *Client) Params(id string) (map[string]interface{}, error) {
+	details, err := c.GetInstance(id)
+	if err == nil {
+		return details.Parameters, nil
+	}
+
+	var e APIError
+	if !(errors.Is(err, ErrNotSupported) || errors.As(err, &e) && (e.StatusCode == 405 || e.StatusCode == 501)) {
+		return nil, err
+	}
+
+	var out map[string]interface{}
+	_, err = c.request("GET", fmt.Sprintf("/b/%s/params.json", id), nil, &out)
+	return out, err
+}
+
+func (c *Client) Create(id, service, plan string, o ProvisionOptions) (Instance, error) {
 	in := struct {
+		ServiceID  string                 `json:"service_id"`
+		PlanID     string                 `json:"plan_id"`
+		OrgID      string                 `json:"organization_guid"`
+		SpaceID    string                 `json:"space_guid"`
+		Context    map[string]interface{} `json:"context"`
+		Parameters map[string]interface{} `json:"parameters,omitempty"`
+	}{
+		ServiceID:  service,
+		PlanID:     plan,
+		OrgID:      o.org(),
+		SpaceID:    o.space(),
+		Context:    o.context(),
+		Parameters: o.Parameters,
+	}
+
+	var out struct {
+		DashboardURL string `json:"dashboard_url"`
+	}
+	q := NewQuery().Bool("accepts_incomplete", !c.Sync)
+	_, err := c.request("PUT", q.Path("/v2/service_instances/%s", id), in, &out)
+	return Instance{ID: id, DashboardURL: out.DashboardURL}, err
+}
+
+func (c *Client) Update(id string, o ProvisionOptions) (Instance, error) {
+	instance, _, err := c.update(id, o)
+	return instance, err
+}
+
+/* update returns the operation to poll, if the broker gave one */
+func (c *Client) update(id string, o ProvisionOptions) (Instance, string, error) {
+	ref, err := c.instanceRef(id)
+	if err != nil {
+		return Instance{}, "", err
+	}
+
+	type previous struct {
 		ServiceID string `json:"service_id"`
 		PlanID    string `json:"plan_id"`
-		OrgID     string `json:"organization_guid"`
-		SpaceID   string `json:"space_guid"`
+	}
+	in := struct {
+		ServiceID      string                 `json:"service_id"`
+		PlanID         string                 `json:"plan_id,omitempty"`
+		Context        map[string]interface{} `json:"context"`
+		Parameters     map[string]interface{} `json:"parameters,omitempty"`
+		PreviousValues *previous              `json:"previous_values,omitempty"`
 	}{
-		ServiceID: service,
-		PlanID:    plan,
-		OrgID:     "boss",
-		SpaceID:   "boss",
+		ServiceID:  ref.ServiceID,
+		Context:    o.context(),
+		Parameters: o.Parameters,
+	}
+	if o.PlanID != "" && o.PlanID != ref.PlanID {
+		in.PlanID = o.PlanID
+		in.PreviousValues = &previous{ServiceID: ref.ServiceID, PlanID: ref.PlanID}
+	}
+	/* the context is replaced wholesale, so keep the name it was given */
+	if _, ok := in.Context["instance_name"]; !ok && ref.Name != "" {
+		in.Context["instance_name"] = ref.Name
 	}
 
-	_, err := c.request("PUT", "/v2/service_instances/"+id, in, nil)
-	return Instance{ID: id}, err
+	var async asyncResponse
+	q := NewQuery().Bool("accepts_incomplete", !c.Sync)
+	_, err = c.request("PATCH", q.Path("/v2/service_instances/%s", id), in, &async)
+	return Instance{ID: id}, async.Operation, err
+}
+
+func (c *Client) UpdateAndWait(id string, o ProvisionOptions, timeout time.Duration) (Instance, error) {
+	instance, operation, err := c.update(id, o)
+	if err != nil || c.DryRun {
+		return instance, err
+	}
+
+	_, err = c.waitForOperation(id, operation, timeout)
+	return instance, err
 }
 
-func (c Client) Update(id, service string) (Instance, error) {
+func (c *Client) Adopt(deployment, id, service, plan string) (Instance, error) {
 	in := struct {
-		ServiceID string `json:"service_id"`
+		Deployment string `json:"deployment"`
+		InstanceID string `json:"instance_id"`
+		ServiceID  string `json:"service_id"`
+		PlanID     string `json:"plan_id"`
 	}{
-		ServiceID: "service",
+		Deployment: deployment,
+		InstanceID: id,
+		ServiceID:  service,
+		PlanID:     plan,
 	}
 
-	_, err := c.request("PATCH", "/v2/service_instances/"+id, in, nil)
+	_, err := c.request("POST", "/b/adopt", in, nil)
 	return Instance{ID: id}, err
 }
 
-func (c Client) Delete(id string) error {
-	_, err := c.request("DELETE", "/v2/service_instances/"+id, nil, nil)
+// Upgrade moves an instance to the maintenance_info (i.e. stemcells
+// and releases) currently advertised by its plan in the catalog.
+func (c *Client) Upgrade(id string) (Instance, error) {
+	instance, _, err := c.upgrade(id)
+	return instance, err
+}
+
+/* upgrade returns the operation to poll, if the broker gave one */
+func (c *Client) upgrade(id string) (Instance, string, error) {
+	ref, err := c.instanceRef(id)
+	if err != nil {
+		return Instance{}, "", err
+	}
+
+	cat, err := c.Catalog()
+	if err != nil {
+		return Instance{}, "", err
+	}
+	service, plan, err := cat.PlanByID(ref.PlanID)
+	if err != nil {
+		return Instance{}, "", err
+	}
+	if plan.MaintenanceInfo == nil {
+		return Instance{}, "", fmt.Errorf("plan '%s' does not advertise any maintenance_info: %w", plan.Name, ErrNotSupported)
+	}
+
+	in := struct {
+		ServiceID       string           `json:"service_id"`
+		PlanID          string           `json:"plan_id"`
+		MaintenanceInfo *MaintenanceInfo `json:"maintenance_info"`
+	}{
+		ServiceID:       ref.ServiceID,
+		PlanID:          ref.PlanID,
+		MaintenanceInfo: plan.MaintenanceInfo,
+	}
+
+	var async asyncResponse
+	q := NewQuery().Bool("accepts_incomplete", !c.Sync)
+	_, err = c.request("PATCH", q.Path("/v2/service_instances/%s", id), in, &async)
+	return Instance{ID: id, Service: service, Plan: plan}, async.Operation, err
+}
+
+// Clone provisions a new instance on the same service and plan, and
+// with the same parameters, as an existing one.
+func (c *Client) Clone(id, newID string, o ProvisionOptions) (Instance, error) {
+	ref, err := c.instanceRef(id)
+	if err != nil {
+		return Instance{}, err
+	}
+
+	params, err := c.Params(id)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return Instance{}, err
+	}
+	if o.Parameters == nil {
+		o.Parameters = params
+	}
+	return c.Create(newID, ref.ServiceID, ref.PlanID, o)
+}
+
+// DashboardURL finds an instance's dashboard, if it has one.
+func (c *Client) DashboardURL(id string) (string, error) {
+	out, err := c.status()
+	if err != nil {
+		return "", err
+	}
+	instance, ok := out.Instances[id]
+	if !ok {
+		return "", InstanceNotFoundError{ID: id}
+	}
+	if instance.DashboardURL != "" {
+		return instance.DashboardURL, nil
+	}
+
+	details, err := c.GetInstance(id)
+	if errors.Is(err, ErrNotSupported) {
+		return "", nil
+	}
+	return details.DashboardURL, err
+}
+
+func (c *Client) UpgradeAndWait(id string, timeout time.Duration) (Instance, error) {
+	instance, operation, err := c.upgrade(id)
+	if err != nil || c.DryRun {
+		return instance, err
+	}
+
+	_, err = c.waitForOperation(id, operation, timeout)
+	return instance, err
+}
+
+// OutdatedInstances finds every instance whose maintenance version is
+// behind what its plan currently advertises.  Only instances of services
+// that support instance retrieval can be checked; the rest of those on
+// plans with maintenance versions are returned as unchecked.
+func (c *Client) OutdatedInstances() (outdated, unchecked []Instance, err error) {
+	instances, err := c.Instances()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	outdated = make([]Instance, 0)
+	unchecked = make([]Instance, 0)
+	for _, instance := range instances {
+		if instance.Service == nil || instance.Plan == nil || instance.Plan.MaintenanceInfo == nil {
+			continue
+		}
+		if !instance.Service.InstancesRetrievable {
+			unchecked = append(unchecked, instance)
+			continue
+		}
+
+		details, err := c.GetInstance(instance.ID)
+		if err != nil {
+			return nil, nil, err
+		}
+		if instance.Plan.Outdated(details.MaintenanceInfo) {
+			outdated = append(outdated, instance)
+		}
+	}
+	return outdated, unchecked, nil
+}
+
+type instanceRef struct {
+	ServiceID string
+	PlanID    string
+	Name      string
+}
+
+func (c *Client) instanceRef(id string) (instanceRef, error) {
+	out, err := c.status()
+	if err != nil {
+		return instanceRef{}, err
+	}
+
+	instance, ok := out.Instances[id]
+	if !ok {
+		return instanceRef{}, InstanceNotFoundError{ID: id}
+	}
+	return instanceRef{ServiceID: instance.ServiceID, PlanID: instance.PlanID, Name: instance.Context.Name}, nil
+}
+
+func (c *Client) Delete(id string) error {
+	ref, err := c.instanceRef(id)
+	if err != nil {
+		return err
+	}
+	return c.delete(id, ref)
+}
+
+// Purge forcibly removes all broker state for an instance, even if its
+// BOSH deployment is already gone (or a deprovision failed half-way).
+// Use Delete for anything else.
+func (c *Client) Purge(id string) error {
+	ref, err := c.instanceRef(id)
+	if err != nil {
+		return err
+	}
+
+	q := NewQuery().
+		Set("service_id", ref.ServiceID).
+		Set("plan_id", ref.PlanID).
+		Bool("purge", true).
+		Bool("accepts_incomplete", false)
+
+	_, err = c.request("DELETE", q.Path("/v2/service_instances/%s", id), nil, nil)
 	return err
 }
 
-func (c Client) Task(id string) (string, error) {
+func (c *Client) delete(id string, ref instanceRef) error {
+	q := NewQuery().
+		Set("service_id", ref.ServiceID).
+		Set("plan_id", ref.PlanID).
+		Bool("accepts_incomplete", !c.Sync)
+
+	_, err := c.request("DELETE", q.Path("/v2/service_instances/%s", id), nil, nil)
+	return err
+}
+
+type Operation struct {
+	State       string `json:"state"`
+	Description string `json:"description"`
+
+	/* how long the broker would like us to wait before asking again */
+	RetryAfter time.Duration `json:"-"`
+}
+
+func (c *Client) LastOperation(id, operation string) (Operation, error) {
+	ref, err := c.instanceRef(id)
+	if err != nil {
+		return Operation{}, err
+	}
+	return c.lastOperation(id, ref, operation)
+}
+
+func (c *Client) lastOperation(id string, ref instanceRef, operation string) (Operation, error) {
+	var op Operation
+
+	q := NewQuery().
+		Set("service_id", ref.ServiceID).
+		Set("plan_id", ref.PlanID).
+		Set("operation", operation)
+
+	res, err := c.call("GET", q.Path("/v2/service_instances/%s/last_operation", id), nil, &op)
+	if err == nil && res.Header.Get("Retry-After") != "" {
+		op.RetryAfter = retryAfter(res.Header.Get("Retry-After"), 0)
+	}
+	return op, err
+}
+
+func (c *Client) waitForOperation(id, operation string, timeout time.Duration) (Operation, error) {
+	ref, err := c.instanceRef(id)
+	if err != nil {
+		return Operation{}, err
+	}
+	return c.waitFor(id, ref, operation, false, timeout)
+}
+
+func (c *Client) CreateAndWait(id, service, plan string, o ProvisionOptions, timeout time.Duration) (Instance, error) {
+	instance, err := c.Create(id, service, plan, o)
+	if err != nil || c.DryRun {
+		return instance, err
+	}
+
+	_, err = c.waitForOperation(id, "", timeout)
+	return instance, err
+}
+
+func (c *Client) DeleteAndWait(id string, timeout time.Duration) error {
+	start := time.Now()
+	ref, err := c.instanceRef(id)
+	if err != nil {
+		return err
+	}
+
+	err = c.delete(id, ref)
+	if err != nil || c.DryRun {
+		return err
+	}
+
+	_, err = c.waitFor(id, ref, "", true, timeout)
+	if err != nil {
+		return err
+	}
+	return c.waitGone(id, ref, start, timeout)
+}
+
+func (c *Client) waitGone(id string, ref instanceRef, start time.Time, timeout time.Duration) error {
+	/* deprovisioning may finish before /b/status catches up */
+	p := c.poller(ref.PlanID, "delete")
+	for {
+		exists, err := c.Exists(id)
+		if err != nil || !exists {
+			c.progressDone(id, err)
+			return err
+		}
+
+		if timeout > 0 && time.Since(start) > timeout {
+			err = TimeoutError{ID: id, Timeout: timeout}
+			c.progressDone(id, err)
+			return err
+		}
+		c.progress(id, "delete", Operation{Description: "waiting for the broker to forget it"}, time.Since(start))
+		p.wait(0)
+	}
+}
+
+type Info struct {
+	Version string `json:"version"`
+	BOSH    struct {
+		Address string `json:"address"`
+		Name    string `json:"name"`
+		UUID    string `json:"uuid"`
+		Version string `json:"version"`
+	} `json:"bosh"`
+	Vault struct {
+		Address     string `json:"address"`
+		Initialized bool   `json:"initialized"`
+		Sealed      bool   `json:"sealed"`
+		Version     string `json:"version"`
+	} `json:"vault"`
+	Forges []struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	} `json:"forges"`
+}
+
+func (c *Client) Info() (Info, error) {
+	var out Info
+	_, err := c.request("GET", "/b/info", nil, &out)
+	return out, err
+}
+
+func (c *Client) Task(id string) (string, error) {
 	return c.text("/b/%s/task.log", id)
 }
 
-func (c Client) Manifest(id string) (string, error) {
+// CancelTask cancels the BOSH task currently running against an
+// instance's deployment or, if task is non-zero, that specific task.
+func (c *Client) CancelTask(id string, task int) error {
+	q := NewQuery()
+	if task > 0 {
+		q.Set("task_id", strconv.Itoa(task))
+	}
+	_, err := c.request("DELETE", q.Path("/b/%s/task", id), nil, nil)
+	return err
+}
+
+func (c *Client) Manifest(id string) (string, error) {
 	return c.text("/b/%s/manifest.yml", id)
 }
 
-func (c Client) Creds(id string) (string, error) {
+// GeneratedManifest asks Blacksmith to render the manifest it would
+// deploy for an instance now, without deploying it; that is what a
+// redeploy would change the stored manifest to.
+func (c *Client) GeneratedManifest(id string) (string, error) {
+	return c.text("/b/%s/generated-manifest.yml", id)
+}
+
+func (c *Client) Creds(id string) (string, error) {
 	return c.text("/b/%s/creds.yml", id)
 }
 
-func (c Client) Redeploy(id string) (string, error) {
+// RegenerateCreds asks Blacksmith to generate new credentials for an
+// instance (in Vault), redeploying it as needed to put them in place.
+func (c *Client) RegenerateCreds(id string) error {
+	_, err := c.request("POST", fmt.Sprintf("/b/%s/recreds", id), nil, nil)
+	return err
+}
+
+// RegenerateCredsAndWait regenerates an instance's credentials, waits
+// for any redeploy to finish, and returns the new credentials.
+func (c *Client) RegenerateCredsAndWait(id string, timeout time.Duration) (string, error) {
+	if err := c.RegenerateCreds(id); err != nil || c.DryRun {
+		return "", err
+	}
+	if _, err := c.waitForOperation(id, "", timeout); err != nil {
+		return "", err
+	}
+	return c.Creds(id)
+}
+
+func (c *Client) Redeploy(id string) (string, error) {
 	return c.text("/b/%s/redeploy", id)
 }
+
+// RedeployAndWait redeploys an instance (patching its manifest with
+// ops, if any are given) and waits for the deployment to finish.
+func (c *Client) RedeployAndWait(id string, ops []PatchOp, timeout time.Duration) error {
+	if _, err := c.RedeployPatched(id, ops); err != nil || c.DryRun {
+		return err
+	}
+	_, err := c.waitForOperation(id, "", timeout)
+	return err
+}
+
+// RedeployWith redeploys an instance from the given manifest,
+// instead of the one Blacksmith has saved for it.
+func (c *Client) RedeployWith(id, manifest string) (string, error) {
+	in := struct {
+		Manifest string `json:"manifest"`
+	}{Manifest: manifest}
+	return c.textFrom(c.do("POST", fmt.Sprintf("/b/%s/redeploy", id), in))
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Command aliases work like git's: an alias in the config file, i.e.
+//
+//	aliases:
+//	  nuke:    delete --force
+//	  redisls: list --service redis
+//
+// is replaced by what it stands for (plus whatever else was on the
+// command line) before the arguments are parsed.  Real commands can't
+// be aliased over, and aliases can refer to other aliases.
+
+/* commandNames are the names (and built-in aliases) of every command */
+func commandNames() map[string]bool {
+	names := make(map[string]bool)
+	t := reflect.TypeOf(opt)
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).Type.Kind() != reflect.Struct {
+			continue
+		}
+		for _, name := range strings.Split(t.Field(i).Tag.Get("cli"), ",") {
+			names[strings.TrimSpace(name)] = true
+		}
+	}
+	return names
+}
+
+/* valueFlags are the global flags that take an argument */
+func valueFlags() map[string]bool {
+	flags := make(map[string]bool)
+	t := reflect.TypeOf(opt)
+	for i := 0; i < t.NumField(); i++ {
+		switch t.Field(i).Type.Kind() {
+		case reflect.Struct, reflect.Bool:
+			continue
+		}
+		for _, flag := range strings.Split(t.Field(i).Tag.Get("cli"), ",") {
+			flags[strings.TrimSpace(flag)] = true
+		}
+	}
+	return flags
+}
+
+// splitWords splits an alias into words, as a shell would, honoring
+// single and double quotes (but nothing fancier).
+func splitWords(s string) ([]string, error) {
+	words := make([]string, 0)
+	var word strings.Builder
+	var quote rune
+	inWord := false
+	for _, r := range s {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			word.WriteRune(r)
+		case r == '\'' || r == '"':
+			quote, inWord = r, true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+// ExpandAliases rewrites command-line arguments (sans the program
+// name), replacing the command with its alias definition, if it is
+// one.
+func ExpandAliases(args []string, aliases map[string]string) ([]string, error) {
+	if len(aliases) == 0 {
+		return args, nil
+	}
+	builtin := commandNames()
+	flags := valueFlags()
+
+	seen := make(map[string]bool)
+	for {
+		i := 0
+		for i < len(args) {
+			a := args[i]
+			if a == "--" || !strings.HasPrefix(a, "-") || a == "-" {
+				break
+			}
+			if flags[a] && !strings.Contains(a, "=") {
+				i++ /* skip the flag's value, too */
+			}
+			i++
+		}
+		if i >= len(args) || args[i] == "--" || builtin[args[i]] {
+			return args, nil
+		}
+
+		name := args[i]
+		def, ok := aliases[name]
+		if !ok {
+			return args, nil
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("alias `%s' refers back to itself", name)
+		}
+		seen[name] = true
+
+		words, err := splitWords(def)
+		if err != nil {
+			return nil, fmt.Errorf("alias `%s': %s", name, err)
+		}
+		if len(words) == 0 {
+			return nil, fmt.Errorf("alias `%s' is empty", name)
+		}
+		expanded := append(append([]string{}, args[:i]...), words...)
+		args = append(expanded, args[i+1:]...)
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sort"
+)
+
+const configFile = "config.yml"
+
+// Target is a Blacksmith broker that boss knows about, keyed in the
+// config file by its URL.
+type Target struct {
+	Name       string `json:"name,omitempty"`
+	Username   string `json:"username,omitempty"`
+	Password   string `json:"password,omitempty"`
+	SkipVerify bool   `json:"skip_verify,omitempty"`
+	Role       string `json:"role,omitempty"`
+
+	/* local nicknames for instances, i.e. prod-db -> 5f0e3c... */
+	Aliases map[string]string `json:"aliases,omitempty"`
+
+	/* where to record the changes made to this target, if anywhere */
+	Audit *AuditConfig `json:"audit,omitempty"`
+}
+
+type Config struct {
+	Current  string                 `json:"target,omitempty"`   /* by name or URL */
+	Defaults map[string]interface{} `json:"defaults,omitempty"` /* by long option name */
+	Roles    map[string][]string    `json:"roles,omitempty"`
+	Targets  map[string]*Target     `json:"targets,omitempty"`
+	Profiles map[string]*Profile    `json:"environments,omitempty"`
+	Aliases  map[string]string      `json:"aliases,omitempty"` /* commands, not instances */
+}
+
+func ReadConfig() (*Config, error) {
+	cfg := &Config{}
+	b, err := ioutil.ReadFile(bossFile(configFile))
+	if os.IsNotExist(err) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	v, err := parseYAML(string(b))
+	if err != nil {
+		return nil, err
+	}
+	if v != nil {
+		if err := convert(v, cfg); err != nil {
+			return nil, err
+		}
+	}
+	return cfg, nil
+}
+
+func (cfg *Config) Write() error {
+	s, err := marshalYAML(cfg)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(bossDir(), 0700); err != nil {
+		return err
+	}
+	tmp := bossFile(configFile + ".tmp")
+	if err := ioutil.WriteFile(tmp, []byte(s), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, bossFile(configFile))
+}
+
+func (cfg *Config) Target(url string) *Target {
+	if cfg.Targets == nil {
+		cfg.Targets = make(map[string]*Target)
+	}
+	if cfg.Targets[url] == nil {
+		cfg.Targets[url] = &Target{}
+	}
+	return cfg.Targets[url]
+}
+
+// URLs returns the URLs of all configured targets, sorted.
+func (cfg *Config) URLs() []string {
+	l := make([]string, 0, len(cfg.Targets))
+	for url := range cfg.Targets {
+		l = append(l, url)
+	}
+	sort.Strings(l)
+	return l
+}
+
+func (cfg *Config) Label(url string) string {
+	if t, ok := cfg.Targets[url]; ok && t.Name != "" {
+		return t.Name
+	}
+	return url
+}
+
+/* convert re-shapes generic (parsed YAML) data into a typed value */
+func convert(in, out interface{}) error {
+	b, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, out)
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// certPool loads CA certificate(s), passed either as PEM or as
+// a path to a PEM file.
+func certPool(ca string) (*x509.CertPool, error) {
+	pem := []byte(ca)
+	if !strings.Contains(ca, "-----BEGIN") {
+		b, err := ioutil.ReadFile(ca)
+		if err != nil {
+			return nil, err
+		}
+		pem = b
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no CA certificates found in %s", ca)
+	}
+	return pool, nil
+}
+
+// tlsClient builds an HTTP client that trusts the given CA
+// certificate(s), passed either as PEM or as a path to a PEM file.
+func tlsClient(ca string, skipVerify bool) (*http.Client, error) {
+	config := &tls.Config{InsecureSkipVerify: skipVerify}
+	if ca != "" {
+		pool, err := certPool(ca)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = pool
+	}
+	return &http.Client{
+		Timeout:   30 * time.Second,
+		Transport: &http.Transport{Proxy: http.ProxyFromEnvironment, TLSClientConfig: config},
+	}, nil
+}
+
+// CredHub is just enough of a CredHub client to store credentials.
+// It is configured like the credhub CLI, via $CREDHUB_SERVER,
+// $CREDHUB_CLIENT, $CREDHUB_SECRET and $CREDHUB_CA_CERT.
+type CredHub struct {
+	Server string
+	Client string
+	Secret string
+	DryRun bool
+
+	ua    *http.Client
+	token string
+}
+
+func CredHubFromEnv() (*CredHub, error) {
+	ch := &CredHub{
+		Server: strings.TrimSuffix(os.Getenv("CREDHUB_SERVER"), "/"),
+		Client: os.Getenv("CREDHUB_CLIENT"),
+		Secret: os.Getenv("CREDHUB_SECRET"),
+	}
+	if ch.Server == "" || ch.Client == "" || ch.Secret == "" {
+		return nil, fmt.Errorf("$CREDHUB_SERVER, $CREDHUB_CLIENT and $CREDHUB_SECRET must all be set")
+	}
+
+	ua, err := tlsClient(os.Getenv("CREDHUB_CA_CERT"), os.Getenv("CREDHUB_SKIP_TLS_VALIDATION") == "true")
+	if err != nil {
+		return nil, err
+	}
+	ch.ua = ua
+	return ch, nil
+}
+
+/* credhub tells us where its UAA is, and UAA gives us a token */
+func (ch *CredHub) login() error {
+	if ch.token != "" {
+		return nil
+	}
+
+	var info struct {
+		AuthServer struct {
+			URL string `json:"url"`
+		} `json:"auth-server"`
+	}
+	res, err := ch.ua.Get(ch.Server + "/info")
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		return fmt.Errorf("credhub: GET /info: %s", res.Status)
+	}
+	if err := json.NewDecoder(res.Body).Decode(&info); err != nil {
+		return err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+	form.Set("response_type", "token")
+	req, err := http.NewRequest("POST", strings.TrimSuffix(info.AuthServer.URL, "/")+"/oauth/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(ch.Client, ch.Secret)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	res, err = ch.ua.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		return fmt.Errorf("credhub: authentication failed: %s", res.Status)
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&token); err != nil {
+		return err
+	}
+	ch.token = token.AccessToken
+	return nil
+}
+
+// Set stores a value credential under the given (absolute) name.
+func (ch *CredHub) Set(name, value string) error {
+	if ch.DryRun {
+		fmt.Fprintf(os.Stdout, "[dry-run] PUT %s/api/v1/data (%s)\n", ch.Server, name)
+		return nil
+	}
+	if err := ch.login(); err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(map[string]string{
+		"name":  name,
+		"type":  "value",
+		"value": value,
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("PUT", ch.Server+"/api/v1/data", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+ch.token)
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := ch.ua.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		return fmt.Errorf("credhub: unable to set %s: %s", name, res.Status)
+	}
+	return nil
+}
+
+// CredsToCredHub writes each instance credential into CredHub, under
+// prefix, i.e. /prefix/password or /prefix/admin/password, and returns
+// the names it wrote.
+func CredsToCredHub(ch *CredHub, creds, prefix string) ([]string, error) {
+	flat, err := FlatCreds(creds, "/")
+	if err != nil {
+		return nil, err
+	}
+
+	prefix = strings.TrimSuffix("/"+strings.Trim(prefix, "/"), "/")
+	names := make([]string, 0, len(flat))
+	for k := range flat {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	for i, k := range names {
+		names[i] = prefix + "/" + k
+		if err := ch.Set(names[i], flat[k]); err != nil {
+			return names[:i], err
+		}
+	}
+	return names, nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Definition describes a service instance portably enough that it
+// can be re-provisioned (on this broker, or another one) from it.
+type Definition struct {
+	ID      string                 `json:"id"`
+	Service string                 `json:"service"`
+	Plan    string                 `json:"plan"`
+	Params  map[string]interface{} `json:"params,omitempty"`
+}
+
+type Definitions struct {
+	Instances []Definition `json:"instances"`
+}
+
+// Export describes the given instances, or all of them if no IDs are
+// given, sorted by ID.
+func (c *Client) Export(ids ...string) (Definitions, error) {
+	out := Definitions{Instances: make([]Definition, 0)}
+
+	instances, err := c.Instances()
+	if err != nil {
+		return out, err
+	}
+
+	want := make(map[string]bool)
+	for _, id := range ids {
+		want[id] = true
+	}
+
+	for _, instance := range instances {
+		if len(ids) > 0 && !want[instance.ID] {
+			continue
+		}
+		delete(want, instance.ID)
+
+		if instance.Service == nil || instance.Plan == nil {
+			return out, fmt.Errorf("instance '%s' is not on any plan in the current catalog", instance.ID)
+		}
+
+		params, err := c.Params(instance.ID)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return out, err
+		}
+
+		out.Instances = append(out.Instances, Definition{
+			ID:      instance.ID,
+			Service: instance.Service.Name,
+			Plan:    instance.Plan.Name,
+			Params:  params,
+		})
+	}
+
+	for id := range want {
+		return out, InstanceNotFoundError{ID: id}
+	}
+
+	sort.Slice(out.Instances, func(i, j int) bool {
+		return out.Instances[i].ID < out.Instances[j].ID
+	})
+	return out, nil
+}
+
+func ParseDefinitions(src string) (Definitions, error) {
+	var out Definitions
+
+	v, err := parseYAML(src)
+	if err != nil {
+		return out, err
+	}
+	if err := convert(v, &out); err != nil {
+		return out, err
+	}
+
+	seen := make(map[string]bool)
+	for i, d := range out.Instances {
+		if d.Service == "" || d.Plan == "" {
+			return out, fmt.Errorf("instance #%d (%s) is missing its service and/or plan", i+1, d.ID)
+		}
+		if d.ID != "" && seen[d.ID] {
+			return out, fmt.Errorf("instance '%s' is defined more than once", d.ID)
+		}
+		seen[d.ID] = true
+	}
+	return out, nil
+}
+
+func (d Definitions) MarshalYAML() (string, error) {
+	return marshalYAML(d)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+)
+
+/* redeploys are (for historical reasons) GET requests */
+func mutating(method, path string) bool {
+	if i := strings.IndexByte(path, '?'); i >= 0 {
+		path = path[:i]
+	}
+	return (method != "GET" && method != "HEAD") || strings.HasSuffix(path, "/redeploy")
+}
+
+// dryRun prints the request that would have been sent, and fakes
+// an empty, successful response to it.  Since nothing was sent, there
+// is nothing to wait for; the *AndWait helpers return straight away.
+func (c *Client) dryRun(version, method, path string, payload []byte) *http.Response {
+	var out io.Writer = os.Stdout
+	if c.DryRunOut != nil {
+		out = c.DryRunOut
+	}
+
+	fmt.Fprintf(out, "[dry-run] %s %s\n", method, c.redactURL(c.base+path))
+	fmt.Fprintf(out, "[dry-run]   X-Broker-API-Version: %s\n", version)
+	if len(payload) > 0 {
+		body := payload
+		if !c.TraceUnsafe {
+			body = redact(body)
+		}
+		fmt.Fprintf(out, "[dry-run]   %s\n", body)
+	}
+
+	return &http.Response{
+		Status:     "200 OK (dry-run)",
+		StatusCode: 200,
+		Proto:      "HTTP/1.1",
+		Header:     make(http.Header),
+		Body:       ioutil.NopCloser(bytes.NewReader([]byte("{}"))),
+	}
+}
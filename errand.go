@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+type Errand struct {
+	Name     string `json:"name"`
+	Task     int    `json:"task_id"`
+	State    string `json:"state"`
+	ExitCode int    `json:"exit_code"`
+}
+
+// Finished reports whether the BOSH task running the errand is over,
+// one way or another.
+func (e Errand) Finished() bool {
+	switch e.State {
+	case "", "queued", "processing", "cancelling":
+		return false
+	}
+	return true
+}
+
+// RunErrand starts the named errand on the deployment behind
+// an instance; it keeps running after this returns.
+func (c *Client) RunErrand(id, name string) (Errand, error) {
+	var out Errand
+	_, err := c.request("POST", fmt.Sprintf("/b/%s/errands/%s", id, name), nil, &out)
+	return out, err
+}
+
+func (c *Client) Errand(id, name string) (Errand, error) {
+	var out Errand
+	_, err := c.request("GET", fmt.Sprintf("/b/%s/errands/%s", id, name), nil, &out)
+	return out, err
+}
+
+// WaitForErrand blocks until an errand is over, writing its output to
+// out as it goes if follow is set, or all at once at the end if not.
+func (c *Client) WaitForErrand(id, name string, follow bool, out io.Writer) (Errand, error) {
+	var e Errand
+	p := c.poller("", "errand")
+	finished := func() (bool, error) {
+		var err error
+		e, err = c.Errand(id, name)
+		return err == nil && e.Finished(), err
+	}
+
+	if !follow {
+		for {
+			done, err := finished()
+			if err != nil {
+				return e, err
+			}
+			if done {
+				break
+			}
+			p.wait(0)
+		}
+	}
+
+	err := c.followUntil(out, func() (string, error) {
+		return c.streamText("/b/%s/errands/%s/output.log", id, name)
+	}, finished)
+	return e, err
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var (
+	ErrUnauthorized      = errors.New("unauthorized")
+	ErrNotFound          = errors.New("not found")
+	ErrAsyncRequired     = errors.New("asynchronous operation required")
+	ErrPlanQuotaExceeded = errors.New("plan quota exceeded")
+	ErrRateLimited       = errors.New("rate limited")
+	ErrOperationFailed   = errors.New("operation failed")
+	ErrTimeout           = errors.New("timed out")
+	ErrServiceNotFound   = errors.New("service not found")
+	ErrPlanNotFound      = errors.New("plan not found")
+	ErrNotSupported      = errors.New("not supported by this broker")
+	ErrConflict          = errors.New("conflict")
+	ErrUnverified        = errors.New("credentials not verified")
+)
+
+type APIError struct {
+	StatusCode  int
+	Status      string
+	Code        string
+	Description string
+	RequestID   string
+	RetryAfter  time.Duration
+}
+
+func (e APIError) Retryable() bool {
+	return e.StatusCode == 429 || e.StatusCode >= 500
+}
+
+func (e APIError) Error() string {
+	msg := fmt.Sprintf("API %s", e.Status)
+	if e.Description != "" {
+		msg += ": " + e.Description
+	}
+	if e.StatusCode == 429 && e.RetryAfter > 0 {
+		msg += fmt.Sprintf(" (retry after %s)", e.RetryAfter)
+	}
+	if e.RequestID != "" {
+		msg += fmt.Sprintf(" (request id %s)", e.RequestID)
+	}
+	return msg
+}
+
+func (e APIError) Is(target error) bool {
+	switch target {
+	case ErrUnauthorized:
+		return e.StatusCode == 401 || e.StatusCode == 403
+	case ErrNotFound:
+		return e.StatusCode == 404 || e.StatusCode == 410
+	case ErrRateLimited:
+		return e.StatusCode == 429
+	case ErrConflict:
+		return e.StatusCode == 409 || e.Code == "ConcurrencyError"
+	case ErrPlanQuotaExceeded:
+		if e.Code == "PlanQuotaExceeded" || e.Code == "QuotaExceeded" {
+			return true
+		}
+		desc := strings.ToLower(e.Description)
+		for _, phrase := range quotaPhrases {
+			if strings.Contains(desc, phrase) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+/* how brokers that don't send an error code say a plan is full */
+var quotaPhrases = []string{
+	"plan limit reached",
+	"service limit reached",
+	"quota exceeded",
+	"quota has been reached",
+}
+
+type AsyncRequiredError struct {
+	Description string
+}
+
+func (e AsyncRequiredError) Error() string {
+	if e.Description != "" {
+		return fmt.Sprintf("broker requires asynchronous operation: %s", e.Description)
+	}
+	return "broker requires asynchronous operation"
+}
+
+func (e AsyncRequiredError) Is(target error) bool {
+	return target == ErrAsyncRequired
+}
+
+type ConflictError struct {
+	Description string
+}
+
+func (e ConflictError) Error() string {
+	return e.Description
+}
+
+func (e ConflictError) Is(target error) bool {
+	return target == ErrConflict
+}
+
+type InstanceNotFoundError struct {
+	ID          string
+	Suggestions []string
+}
+
+func (e InstanceNotFoundError) Error() string {
+	return fmt.Sprintf("No instance found matching `%s'", e.ID) + didYouMean(e.Suggestions, func(s string) string {
+		return "`" + s + "'"
+	})
+}
+
+func (e InstanceNotFoundError) Is(target error) bool {
+	return target == ErrNotFound
+}
+
+type ServiceNotFoundError struct {
+	Service     string
+	Suggestions []string
+}
+
+func (e ServiceNotFoundError) Error() string {
+	return fmt.Sprintf("service '%s' not found", e.Service) + didYouMean(e.Suggestions, singleQuote)
+}
+
+func (e ServiceNotFoundError) Is(target error) bool {
+	return target == ErrServiceNotFound || target == ErrNotFound
+}
+
+type PlanNotFoundError struct {
+	Service     string
+	Plan        string
+	Suggestions []string
+}
+
+func (e PlanNotFoundError) Error() string {
+	if e.Service == "" {
+		return fmt.Sprintf("plan '%s' not found", e.Plan) + didYouMean(e.Suggestions, singleQuote)
+	}
+	return fmt.Sprintf("service '%s' / plan '%s' not found", e.Service, e.Plan) + didYouMean(e.Suggestions, singleQuote)
+}
+
+func singleQuote(s string) string {
+	return "'" + s + "'"
+}
+
+func (e PlanNotFoundError) Is(target error) bool {
+	return target == ErrPlanNotFound || target == ErrNotFound
+}
+
+type CatalogUnavailableError struct {
+	Err error
+}
+
+func (e CatalogUnavailableError) Error() string {
+	return fmt.Sprintf("service catalog unavailable: %s", e.Err)
+}
+
+func (e CatalogUnavailableError) Unwrap() error {
+	return e.Err
+}
+
+type OperationFailedError struct {
+	ID          string
+	Description string
+}
+
+func (e OperationFailedError) Error() string {
+	if e.Description != "" {
+		return fmt.Sprintf("operation on instance `%s' failed: %s", e.ID, e.Description)
+	}
+	return fmt.Sprintf("operation on instance `%s' failed", e.ID)
+}
+
+func (e OperationFailedError) Is(target error) bool {
+	return target == ErrOperationFailed
+}
+
+type TimeoutError struct {
+	ID      string
+	Timeout time.Duration
+}
+
+func (e TimeoutError) Error() string {
+	return fmt.Sprintf("timed out after %s waiting on instance `%s'", e.Timeout, e.ID)
+}
+
+func (e TimeoutError) Is(target error) bool {
+	return target == ErrTimeout
+}
+
+func apiError(res *http.Response, b []byte) error {
+	var body struct {
+		Error       string `json:"error"`
+		Description string `json:"description"`
+	}
+	/* not every broker error has an OSB error body */
+	json.Unmarshal(b, &body)
+
+	if res.StatusCode == 422 && body.Error == "AsyncRequired" {
+		return AsyncRequiredError{Description: body.Description}
+	}
+
+	rid := ""
+	if res.Request != nil {
+		rid = res.Request.Header.Get("X-Request-ID")
+	}
+
+	var wait time.Duration
+	if res.StatusCode == 429 {
+		wait = retryAfter(res.Header.Get("Retry-After"), 0)
+	}
+
+	return APIError{
+		StatusCode:  res.StatusCode,
+		Status:      res.Status,
+		Code:        body.Error,
+		Description: body.Description,
+		RequestID:   rid,
+		RetryAfter:  wait,
+	}
+}
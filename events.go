@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Event is one entry in the BOSH director's event history
+// for the deployment behind a service instance.
+type Event struct {
+	ID         string                 `json:"id"`
+	Timestamp  int64                  `json:"timestamp"`
+	User       string                 `json:"user"`
+	Action     string                 `json:"action"`
+	ObjectType string                 `json:"object_type"`
+	ObjectName string                 `json:"object_name"`
+	Task       string                 `json:"task,omitempty"`
+	Instance   string                 `json:"instance,omitempty"`
+	Error      string                 `json:"error,omitempty"`
+	Context    map[string]interface{} `json:"context,omitempty"`
+}
+
+func (e Event) Time() time.Time {
+	return time.Unix(e.Timestamp, 0)
+}
+
+func (e Event) Object() string {
+	if e.ObjectName == "" {
+		return e.ObjectType
+	}
+	return e.ObjectType + " " + e.ObjectName
+}
+
+// Events fetches an instance's deployment history, oldest first.
+func (c *Client) Events(id string) ([]Event, error) {
+	out := make([]Event, 0)
+	_, err := c.request("GET", fmt.Sprintf("/b/%s/events.json", id), nil, &out)
+	sort.SliceStable(out, func(i, j int) bool {
+		return out[i].Timestamp < out[j].Timestamp
+	})
+	return out, err
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"crypto/x509"
+	"errors"
+	"net"
+)
+
+// Exit codes are the same for every command, so that scripts can tell
+// what went wrong without scraping error messages.
+const (
+	ExitOK          = 0
+	ExitFailure     = 1 /* anything not covered below */
+	ExitUsage       = 2 /* bad arguments, options or configuration */
+	ExitUnreachable = 3
+	ExitTLS         = 4
+	ExitAuth        = 5 /* bad credentials, or not permitted */
+	ExitTimeout     = 6
+	ExitNotFound    = 7
+	ExitConflict    = 8  /* already exists, or in use */
+	ExitTaskFailed  = 9  /* the broker (or BOSH) tried, and failed */
+	ExitUnverified  = 10 /* reachable, but the credentials couldn't be checked */
+	ExitUnsafe      = 11 /* refused to print secrets where they'd be kept */
+)
+
+func exitCode(err error) int {
+	var (
+		unknown  x509.UnknownAuthorityError
+		invalid  x509.CertificateInvalidError
+		hostname x509.HostnameError
+		neterr   net.Error
+		operr    *net.OpError
+	)
+	switch {
+	case err == nil:
+		return ExitOK
+	case errors.Is(err, ErrUnauthorized):
+		return ExitAuth
+	case errors.Is(err, ErrNotFound):
+		return ExitNotFound
+	case errors.Is(err, ErrConflict):
+		return ExitConflict
+	case errors.Is(err, ErrTimeout):
+		return ExitTimeout
+	case errors.Is(err, ErrOperationFailed):
+		return ExitTaskFailed
+	case errors.As(err, &unknown), errors.As(err, &invalid), errors.As(err, &hostname):
+		return ExitTLS
+	case errors.As(err, &neterr) && neterr.Timeout():
+		return ExitTimeout
+	case errors.As(err, &operr):
+		return ExitUnreachable
+	}
+	return ExitFailure
+}
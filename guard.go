@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// environment variables that give away a CI system, whose
+// build logs tend to be kept (and shared) for a long time
+var ciVariables = []string{
+	"CI",
+	"BUILD_ID",
+	"BUILD_PIPELINE_NAME",
+	"BUILDKITE",
+	"CIRCLECI",
+	"GITHUB_ACTIONS",
+	"GITLAB_CI",
+	"JENKINS_URL",
+	"TEAMCITY_VERSION",
+	"TF_BUILD",
+	"TRAVIS",
+}
+
+func stdoutPath() string {
+	fi, err := os.Stdout.Stat()
+	if err != nil || !fi.Mode().IsRegular() {
+		return ""
+	}
+
+	if runtime.GOOS == "linux" {
+		if path, err := os.Readlink("/proc/self/fd/1"); err == nil {
+			return path
+		}
+	}
+	return os.Stdout.Name()
+}
+
+func inGitRepo(path string) (string, bool) {
+	dir, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return "", false
+	}
+
+	for {
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			return dir, true
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
+
+// SecretExposure explains why printing secrets to standard output
+// right now is probably a bad idea, or returns "" if it seems fine.
+func SecretExposure() string {
+	if path := stdoutPath(); path != "" {
+		if repo, ok := inGitRepo(path); ok {
+			return fmt.Sprintf("standard output is being written to %s, inside the git repository %s", path, repo)
+		}
+	}
+
+	if !isTTY(os.Stdout) {
+		for _, v := range ciVariables {
+			if os.Getenv(v) != "" {
+				return fmt.Sprintf("this looks like a CI build (via $%s), and standard output is probably being logged", v)
+			}
+		}
+	}
+	return ""
+}
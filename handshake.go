@@ -0,0 +1,510 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TestService connects to the service an instance's credentials point
+// at and, for redis, postgres, mysql and rabbitmq, logs in with them.
+// It returns where it connected, and a note on how far it got; if it
+// got in, but couldn't check the credentials, the error is ErrUnverified.
+func TestService(creds string, timeout time.Duration, hints ...string) (Endpoint, string, error) {
+	v, err := parseYAML(creds)
+	if err != nil {
+		return Endpoint{}, "", err
+	}
+	e, ok := findEndpoint(v)
+	if !ok {
+		return e, "", fmt.Errorf("unable to determine a host and port from the instance credentials")
+	}
+
+	conn, err := net.DialTimeout("tcp", e.String(), timeout)
+	if err != nil {
+		return e, "", err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	m := asMap(v)
+	user := credField(m, "username", "user", "login")
+	pass := credField(m, "password", "pass")
+	db := credField(m, "database", "db", "dbname")
+
+	switch scheme := serviceScheme(e.Port, hints); scheme {
+	case "redis":
+		return e, "redis AUTH and PING", redisHandshake(conn, user, pass)
+	case "postgres":
+		return e, "postgres login", pgHandshake(conn, user, pass, db)
+	case "mysql":
+		note, err := mysqlHandshake(conn, user, pass, db)
+		return e, note, err
+	case "amqp":
+		return e, "AMQP login", amqpHandshake(conn, user, pass)
+	}
+	return e, "TCP connect only", nil
+}
+
+func redisHandshake(conn net.Conn, user, pass string) error {
+	r := bufio.NewReader(conn)
+	cmd := func(args ...string) (string, error) {
+		var b strings.Builder
+		fmt.Fprintf(&b, "*%d\r\n", len(args))
+		for _, a := range args {
+			fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(a), a)
+		}
+		if _, err := io.WriteString(conn, b.String()); err != nil {
+			return "", err
+		}
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if strings.HasPrefix(line, "-") {
+			return "", fmt.Errorf("redis: %s", line[1:])
+		}
+		return line, nil
+	}
+
+	if pass != "" {
+		args := []string{"AUTH"}
+		if user != "" {
+			args = append(args, user)
+		}
+		if _, err := cmd(append(args, pass)...); err != nil {
+			return err
+		}
+	}
+	reply, err := cmd("PING")
+	if err != nil {
+		return err
+	}
+	if reply != "+PONG" {
+		return fmt.Errorf("redis: unexpected reply to PING: %s", reply)
+	}
+	return nil
+}
+
+func pgHandshake(conn net.Conn, user, pass, db string) error {
+	if db == "" {
+		db = user
+	}
+	params := "user\x00" + user + "\x00database\x00" + db + "\x00\x00"
+	startup := make([]byte, 8, 8+len(params))
+	binary.BigEndian.PutUint32(startup[0:], uint32(8+len(params)))
+	binary.BigEndian.PutUint32(startup[4:], 196608) /* protocol 3.0 */
+	if _, err := conn.Write(append(startup, params...)); err != nil {
+		return err
+	}
+
+	send := func(typ byte, body []byte) error {
+		msg := []byte{typ, 0, 0, 0, 0}
+		binary.BigEndian.PutUint32(msg[1:], uint32(4+len(body)))
+		_, err := conn.Write(append(msg, body...))
+		return err
+	}
+
+	r := bufio.NewReader(conn)
+	var scram *scramClient
+	for {
+		typ, body, err := pgRead(r)
+		if err != nil {
+			return err
+		}
+
+		switch typ {
+		case 'E':
+			return fmt.Errorf("postgres: %s", pgError(body))
+
+		case 'Z':
+			/* ready for query; we're in */
+			return send('X', nil)
+
+		case 'R':
+			if len(body) < 4 {
+				return fmt.Errorf("postgres: malformed authentication request")
+			}
+			switch binary.BigEndian.Uint32(body) {
+			case 0:
+				/* authentication ok */
+			case 3:
+				err = send('p', []byte(pass+"\x00"))
+			case 5:
+				if len(body) < 8 {
+					return fmt.Errorf("postgres: malformed MD5 authentication request")
+				}
+				inner := md5.Sum([]byte(pass + user))
+				outer := md5.Sum(append([]byte(hex.EncodeToString(inner[:])), body[4:8]...))
+				err = send('p', []byte("md5"+hex.EncodeToString(outer[:])+"\x00"))
+			case 10:
+				if !strings.Contains(string(body[4:]), "SCRAM-SHA-256\x00") {
+					return fmt.Errorf("postgres: no supported SASL mechanism offered")
+				}
+				scram = newScramClient(pass)
+				first := scram.first()
+				msg := append([]byte("SCRAM-SHA-256\x00"), 0, 0, 0, 0)
+				binary.BigEndian.PutUint32(msg[len(msg)-4:], uint32(len(first)))
+				err = send('p', append(msg, first...))
+			case 11:
+				if scram == nil {
+					return fmt.Errorf("postgres: unexpected SASL challenge")
+				}
+				var final string
+				if final, err = scram.final(string(body[4:])); err == nil {
+					err = send('p', []byte(final))
+				}
+			case 12:
+				if scram == nil {
+					return fmt.Errorf("postgres: unexpected SASL outcome")
+				}
+				err = scram.verify(string(body[4:]))
+			default:
+				return fmt.Errorf("postgres: unsupported authentication method %d", binary.BigEndian.Uint32(body))
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func pgRead(r *bufio.Reader) (byte, []byte, error) {
+	hdr := make([]byte, 5)
+	if _, err := io.ReadFull(r, hdr); err != nil {
+		return 0, nil, err
+	}
+	n := int(binary.BigEndian.Uint32(hdr[1:])) - 4
+	if n < 0 || n > 1<<20 {
+		return 0, nil, fmt.Errorf("postgres: malformed message")
+	}
+	body := make([]byte, n)
+	_, err := io.ReadFull(r, body)
+	return hdr[0], body, err
+}
+
+func pgError(body []byte) string {
+	for _, field := range bytes.Split(body, []byte{0}) {
+		if len(field) > 1 && field[0] == 'M' {
+			return string(field[1:])
+		}
+	}
+	return "authentication failed"
+}
+
+type scramClient struct {
+	pass   string
+	nonce  string
+	bare   string
+	salted []byte
+	auth   string
+}
+
+func newScramClient(pass string) *scramClient {
+	b := make([]byte, 18)
+	rand.Read(b)
+	return &scramClient{pass: pass, nonce: base64.StdEncoding.EncodeToString(b)}
+}
+
+func (s *scramClient) first() string {
+	/* postgres takes the user name from the startup message */
+	s.bare = "n=,r=" + s.nonce
+	return "n,," + s.bare
+}
+
+func (s *scramClient) final(server string) (string, error) {
+	var nonce, salt string
+	iter := 0
+	for _, kv := range strings.Split(server, ",") {
+		switch {
+		case strings.HasPrefix(kv, "r="):
+			nonce = kv[2:]
+		case strings.HasPrefix(kv, "s="):
+			salt = kv[2:]
+		case strings.HasPrefix(kv, "i="):
+			iter, _ = strconv.Atoi(kv[2:])
+		}
+	}
+	rawSalt, err := base64.StdEncoding.DecodeString(salt)
+	if err != nil || !strings.HasPrefix(nonce, s.nonce) || iter <= 0 {
+		return "", fmt.Errorf("postgres: malformed SCRAM challenge")
+	}
+
+	s.salted = pbkdf2SHA256([]byte(s.pass), rawSalt, iter)
+	clientKey := hmacSHA256(s.salted, "Client Key")
+	storedKey := sha256.Sum256(clientKey)
+
+	bare := "c=biws,r=" + nonce
+	s.auth = s.bare + "," + server + "," + bare
+	proof := hmacSHA256(storedKey[:], s.auth)
+	for i := range proof {
+		proof[i] ^= clientKey[i]
+	}
+	return bare + ",p=" + base64.StdEncoding.EncodeToString(proof), nil
+}
+
+func (s *scramClient) verify(server string) error {
+	want := hmacSHA256(hmacSHA256(s.salted, "Server Key"), s.auth)
+	if server != "v="+base64.StdEncoding.EncodeToString(want) {
+		return fmt.Errorf("postgres: server failed SCRAM verification")
+	}
+	return nil
+}
+
+func hmacSHA256(key []byte, msg string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(msg))
+	return h.Sum(nil)
+}
+
+/* one block of PBKDF2-HMAC-SHA256 is all SCRAM-SHA-256 needs */
+func pbkdf2SHA256(pass, salt []byte, iter int) []byte {
+	h := hmac.New(sha256.New, pass)
+	h.Write(salt)
+	h.Write([]byte{0, 0, 0, 1})
+	u := h.Sum(nil)
+	out := append([]byte(nil), u...)
+	for i := 1; i < iter; i++ {
+		h.Reset()
+		h.Write(u)
+		u = h.Sum(u[:0])
+		for j := range out {
+			out[j] ^= u[j]
+		}
+	}
+	return out
+}
+
+func mysqlHandshake(conn net.Conn, user, pass, db string) (string, error) {
+	r := bufio.NewReader(conn)
+	seq, greeting, err := mysqlRead(r)
+	if err != nil {
+		return "", err
+	}
+	if len(greeting) > 0 && greeting[0] == 0xff {
+		return "", mysqlError(greeting)
+	}
+	if len(greeting) < 1 || greeting[0] != 10 {
+		return "", fmt.Errorf("mysql: unsupported protocol version")
+	}
+
+	/* protocol, version, connection id, salt (part 1), filler,
+	   capabilities, charset, status, capabilities, salt length,
+	   reserved, salt (part 2), auth plugin */
+	p := greeting[1:]
+	p = p[bytes.IndexByte(p, 0)+1:]
+	if len(p) < 4+8+1+2+1+2+2+1+10 {
+		return "", fmt.Errorf("mysql: malformed handshake")
+	}
+	salt := append([]byte(nil), p[4:12]...)
+	p = p[4+8+1+2+1+2+2+1+10:]
+	if i := bytes.IndexByte(p, 0); i >= 0 {
+		salt = append(salt, p[:i]...)
+		p = p[i+1:]
+	}
+	plugin := string(bytes.TrimRight(p, "\x00"))
+
+	flags := uint32(0x1 | 0x200 | 0x8000 | 0x80000) /* long password, 4.1, secure conn, plugin auth */
+	if db != "" {
+		flags |= 0x8
+	}
+	auth := mysqlScramble(plugin, pass, salt)
+
+	res := make([]byte, 32)
+	binary.LittleEndian.PutUint32(res[0:], flags)
+	binary.LittleEndian.PutUint32(res[4:], 1<<24)
+	res[8] = 33 /* utf8 */
+	res = append(res, user...)
+	res = append(res, 0, byte(len(auth)))
+	res = append(res, auth...)
+	if db != "" {
+		res = append(append(res, db...), 0)
+	}
+	res = append(append(res, plugin...), 0)
+
+	for {
+		seq++
+		if err := mysqlWrite(conn, seq, res); err != nil {
+			return "", err
+		}
+		if seq, res, err = mysqlRead(r); err != nil {
+			return "", err
+		}
+		if len(res) == 0 {
+			return "", fmt.Errorf("mysql: empty response")
+		}
+
+		switch res[0] {
+		case 0x00:
+			return "mysql login", nil
+		case 0xff:
+			return "", mysqlError(res)
+		case 0xfe:
+			/* switch to another auth plugin */
+			p := res[1:]
+			i := bytes.IndexByte(p, 0)
+			if i < 0 {
+				return "", fmt.Errorf("mysql: malformed auth switch request")
+			}
+			plugin = string(p[:i])
+			res = mysqlScramble(plugin, pass, bytes.TrimRight(p[i+1:], "\x00"))
+		case 0x01:
+			if len(res) > 1 && res[1] == 3 {
+				/* fast auth succeeded; an OK packet follows */
+				if seq, res, err = mysqlRead(r); err != nil {
+					return "", err
+				}
+				if len(res) > 0 && res[0] == 0xff {
+					return "", mysqlError(res)
+				}
+				if len(res) == 0 || res[0] != 0x00 {
+					return "", fmt.Errorf("mysql: unexpected response after fast authentication")
+				}
+				return "mysql login", nil
+			}
+			/* full caching_sha2 authentication needs TLS or an RSA key,
+			   so all we know is that the server is there */
+			return "mysql handshake", fmt.Errorf("mysql: the server wants TLS before it will check the password: %w", ErrUnverified)
+		default:
+			return "", fmt.Errorf("mysql: unexpected response 0x%02x", res[0])
+		}
+	}
+}
+
+func mysqlScramble(plugin, pass string, salt []byte) []byte {
+	if pass == "" {
+		return nil
+	}
+	xor := func(a, b []byte) []byte {
+		for i := range a {
+			a[i] ^= b[i]
+		}
+		return a
+	}
+
+	if plugin == "caching_sha2_password" {
+		a := sha256.Sum256([]byte(pass))
+		b := sha256.Sum256(a[:])
+		c := sha256.Sum256(append(b[:], salt...))
+		return xor(a[:], c[:])
+	}
+	a := sha1.Sum([]byte(pass))
+	b := sha1.Sum(a[:])
+	c := sha1.Sum(append(append([]byte(nil), salt...), b[:]...))
+	return xor(a[:], c[:])
+}
+
+func mysqlRead(r *bufio.Reader) (byte, []byte, error) {
+	hdr := make([]byte, 4)
+	if _, err := io.ReadFull(r, hdr); err != nil {
+		return 0, nil, err
+	}
+	n := int(hdr[0]) | int(hdr[1])<<8 | int(hdr[2])<<16
+	body := make([]byte, n)
+	_, err := io.ReadFull(r, body)
+	return hdr[3], body, err
+}
+
+func mysqlWrite(w io.Writer, seq byte, body []byte) error {
+	n := len(body)
+	_, err := w.Write(append([]byte{byte(n), byte(n >> 8), byte(n >> 16), seq}, body...))
+	return err
+}
+
+func mysqlError(b []byte) error {
+	if len(b) < 3 {
+		return fmt.Errorf("mysql: malformed error packet")
+	}
+	msg := b[3:]
+	if len(msg) > 6 && msg[0] == '#' {
+		msg = msg[6:]
+	}
+	return fmt.Errorf("mysql: %s", string(msg))
+}
+
+func amqpHandshake(conn net.Conn, user, pass string) error {
+	if _, err := conn.Write([]byte("AMQP\x00\x00\x09\x01")); err != nil {
+		return err
+	}
+
+	r := bufio.NewReader(conn)
+	class, method, _, err := amqpRead(r)
+	if err != nil {
+		return err
+	}
+	if class != 10 || method != 10 {
+		return fmt.Errorf("amqp: expected connection.start, got %d.%d", class, method)
+	}
+
+	/* connection.start-ok, with no client properties, PLAIN auth */
+	var args bytes.Buffer
+	args.Write([]byte{0, 10, 0, 11})
+	args.Write([]byte{0, 0, 0, 0})
+	args.WriteByte(5)
+	args.WriteString("PLAIN")
+	response := "\x00" + user + "\x00" + pass
+	binary.Write(&args, binary.BigEndian, uint32(len(response)))
+	args.WriteString(response)
+	args.WriteByte(5)
+	args.WriteString("en_US")
+
+	frame := []byte{1, 0, 0, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(frame[3:], uint32(args.Len()))
+	frame = append(append(frame, args.Bytes()...), 0xce)
+	if _, err := conn.Write(frame); err != nil {
+		return err
+	}
+
+	class, method, body, err := amqpRead(r)
+	if err == io.EOF {
+		return fmt.Errorf("amqp: connection closed during login (bad credentials?)")
+	}
+	if err != nil {
+		return err
+	}
+	if class == 10 && method == 50 && len(body) > 2 {
+		code := binary.BigEndian.Uint16(body)
+		n := int(body[2])
+		if 3+n <= len(body) {
+			return fmt.Errorf("amqp: %d %s", code, string(body[3:3+n]))
+		}
+		return fmt.Errorf("amqp: connection closed (%d)", code)
+	}
+	if class != 10 || method != 30 {
+		return fmt.Errorf("amqp: expected connection.tune, got %d.%d", class, method)
+	}
+	return nil
+}
+
+func amqpRead(r *bufio.Reader) (uint16, uint16, []byte, error) {
+	hdr := make([]byte, 7)
+	if _, err := io.ReadFull(r, hdr); err != nil {
+		return 0, 0, nil, err
+	}
+	if string(hdr[:4]) == "AMQP" {
+		return 0, 0, nil, fmt.Errorf("amqp: server does not support AMQP 0-9-1")
+	}
+	n := int(binary.BigEndian.Uint32(hdr[3:]))
+	if hdr[0] != 1 || n < 4 || n > 1<<20 {
+		return 0, 0, nil, fmt.Errorf("amqp: unexpected frame")
+	}
+	body := make([]byte, n+1)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, 0, nil, err
+	}
+	return binary.BigEndian.Uint16(body), binary.BigEndian.Uint16(body[2:]), body[4:n], nil
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"net"
+	"testing"
+)
+
+func TestScram(t *testing.T) {
+	/* the SCRAM-SHA-256 exchange from RFC 7677, section 3 */
+	s := &scramClient{pass: "pencil", nonce: "rOprNGfwEbeRWgbNEkqO", bare: "n=user,r=rOprNGfwEbeRWgbNEkqO"}
+	final, err := s.final("r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	want := "c=biws,r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,p=dHzbZapWIk4jUhN+Ute9ytag9zjfMHgsqmmiz7AndVQ="
+	if final != want {
+		t.Errorf("client-final was %s, not %s", final, want)
+	}
+	if err := s.verify("v=6rriTRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4="); err != nil {
+		t.Errorf("server signature did not verify: %s", err)
+	}
+	if err := s.verify("v=AAAA"); err == nil {
+		t.Errorf("bad server signature verified")
+	}
+
+	for _, challenge := range []string{
+		"r=someone-elses-nonce,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096",
+		"r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==",
+		"r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=!!!,i=4096",
+	} {
+		if _, err := s.final(challenge); err == nil {
+			t.Errorf("%s: expected an error", challenge)
+		}
+	}
+}
+
+func TestMysqlScramble(t *testing.T) {
+	/* as recorded from go-sql-driver/mysql's auth tests */
+	tests := []struct {
+		plugin string
+		salt   []byte
+		want   []byte
+	}{
+		{"mysql_native_password",
+			[]byte{70, 114, 92, 94, 1, 38, 11, 116, 63, 114, 23, 101, 126, 103, 26, 95, 81, 17, 24, 21},
+			[]byte{53, 177, 140, 159, 251, 189, 127, 53, 109, 252, 172, 50, 211, 192, 240, 164, 26, 48, 207, 45}},
+		{"caching_sha2_password",
+			[]byte{90, 105, 74, 126, 30, 48, 37, 56, 3, 23, 115, 127, 69, 22, 41, 84, 32, 123, 43, 118},
+			[]byte{102, 32, 5, 35, 143, 161, 140, 241, 171, 232, 56, 139, 43, 14, 107, 196, 249, 170, 147, 60,
+				220, 204, 120, 178, 214, 15, 184, 150, 26, 61, 57, 235}},
+	}
+	for _, test := range tests {
+		if got := mysqlScramble(test.plugin, "secret", test.salt); !bytes.Equal(got, test.want) {
+			t.Errorf("%s: scrambled to %v, not %v", test.plugin, got, test.want)
+		}
+	}
+	if got := mysqlScramble("mysql_native_password", "", []byte("salt")); got != nil {
+		t.Errorf("empty password scrambled to %v", got)
+	}
+}
+
+// mysqlServer greets the client with plugin and salt, sends back the
+// scrambled password it gets, and then replies with each of replies.
+func mysqlServer(plugin string, salt []byte, replies ...[]byte) (net.Conn, <-chan []byte) {
+	client, server := net.Pipe()
+	scrambled := make(chan []byte, 1)
+	go func() {
+		defer server.Close()
+		defer close(scrambled)
+
+		g := append([]byte{10}, "8.0.0\x00"...)
+		g = append(g, 1, 0, 0, 0)
+		g = append(g, salt[:8]...)
+		g = append(g, 0, 0xff, 0xff, 33, 2, 0, 0xff, 0xff, byte(len(salt)+1))
+		g = append(g, make([]byte, 10)...)
+		g = append(append(g, salt[8:]...), 0)
+		g = append(append(g, plugin...), 0)
+		if mysqlWrite(server, 0, g) != nil {
+			return
+		}
+
+		_, res, err := mysqlRead(bufio.NewReader(server))
+		if err != nil || len(res) < 34 {
+			return
+		}
+		/* flags, max packet size, charset and filler, then the user */
+		p := res[32:]
+		p = p[bytes.IndexByte(p, 0)+1:]
+		scrambled <- p[1 : 1+int(p[0])]
+
+		for i, reply := range replies {
+			if mysqlWrite(server, byte(2+i), reply) != nil {
+				return
+			}
+		}
+	}()
+	return client, scrambled
+}
+
+func TestMysqlHandshake(t *testing.T) {
+	native := []byte{70, 114, 92, 94, 1, 38, 11, 116, 63, 114, 23, 101, 126, 103, 26, 95, 81, 17, 24, 21}
+	sha2 := []byte{90, 105, 74, 126, 30, 48, 37, 56, 3, 23, 115, 127, 69, 22, 41, 84, 32, 123, 43, 118}
+	ok := []byte{0, 0, 0, 2, 0, 0, 0}
+
+	tests := []struct {
+		name    string
+		plugin  string
+		salt    []byte
+		replies [][]byte
+		check   func(error) bool
+	}{
+		{"native login", "mysql_native_password", native, [][]byte{ok},
+			func(err error) bool { return err == nil }},
+		{"fast caching_sha2 login", "caching_sha2_password", sha2, [][]byte{{1, 3}, ok},
+			func(err error) bool { return err == nil }},
+		{"full caching_sha2 authentication", "caching_sha2_password", sha2, [][]byte{{1, 4}},
+			func(err error) bool { return errors.Is(err, ErrUnverified) }},
+		{"access denied", "mysql_native_password", native, [][]byte{append([]byte{0xff, 0x15, 0x04}, "#28000Access denied"...)},
+			func(err error) bool { return err != nil && err.Error() == "mysql: Access denied" }},
+		{"short error packet", "mysql_native_password", native, [][]byte{{0xff}},
+			func(err error) bool { return err != nil }},
+		{"empty packet after fast auth", "caching_sha2_password", sha2, [][]byte{{1, 3}, {}},
+			func(err error) bool { return err != nil }},
+		{"short error after fast auth", "caching_sha2_password", sha2, [][]byte{{1, 3}, {0xff, 0x15}},
+			func(err error) bool { return err != nil }},
+	}
+	for _, test := range tests {
+		conn, scrambled := mysqlServer(test.plugin, test.salt, test.replies...)
+		_, err := mysqlHandshake(conn, "root", "secret", "")
+		conn.Close()
+		if !test.check(err) {
+			t.Errorf("%s: unexpected result: %v", test.name, err)
+		}
+		if got, want := <-scrambled, mysqlScramble(test.plugin, "secret", test.salt); !bytes.Equal(got, want) {
+			t.Errorf("%s: server got %v, not %v", test.name, got, want)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"os/user"
+	"strings"
+	"time"
+)
+
+const historyFile = "history.jsonl"
+
+// mutatingCommands are those that boss records in its local history,
+// for reconstructing who did what (and replaying it) later.
+var mutatingCommands = map[string]bool{
+	"adopt":        true,
+	"apply":        true,
+	"cancel":       true,
+	"clone":        true,
+	"create":       true,
+	"delete":       true,
+	"deprovision":  true,
+	"errand":       true,
+	"import":       true,
+	"migrate":      true,
+	"provision":    true,
+	"purge":        true,
+	"recreds":      true,
+	"redeploy":     true,
+	"restore":      true,
+	"rotate-creds": true,
+	"update":       true,
+	"upgrade":      true,
+	"upgrade-all":  true,
+}
+
+// HistoryEntry is one line of ~/.boss/history.jsonl.
+type HistoryEntry struct {
+	Time        time.Time `json:"time"`
+	User        string    `json:"user,omitempty"`
+	Target      string    `json:"target"`
+	Environment string    `json:"environment,omitempty"`
+	Command     string    `json:"command"`
+	Instance    string    `json:"instance,omitempty"`
+	Args        []string  `json:"args"` /* everything after `boss', sans passwords */
+	Outcome     string    `json:"outcome"`
+	Error       string    `json:"error,omitempty"`
+}
+
+/* the operation in progress, if it is one worth remembering */
+var history *HistoryEntry
+
+func beginHistory(command string, args, positional []string) {
+	if !opt.KeepHistory || opt.DryRun || opt.Help || !mutatingCommands[command] {
+		return
+	}
+	history = &HistoryEntry{
+		Time:        time.Now().UTC(),
+		User:        whoami(),
+		Target:      opt.URL,
+		Environment: opt.Environment,
+		Command:     command,
+		Args:        redactArgs(args),
+	}
+	if len(positional) > 0 {
+		history.Instance = positional[0]
+	}
+}
+
+func whoami() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
+
+// About notes which instance the operation in progress is about, once
+// it has been resolved from whatever the user typed.
+func (h *HistoryEntry) About(id string) {
+	if h != nil {
+		h.Instance = id
+	}
+}
+
+// endHistory appends the operation in progress (if any) to the history
+// file.  History is a nice-to-have, so this never fails the command.
+func endHistory(code int, e error) {
+	if history == nil {
+		return
+	}
+	h := *history
+	history = nil
+
+	h.Outcome = "succeeded"
+	if code != 0 {
+		h.Outcome = "failed"
+	}
+	if e != nil {
+		h.Error = e.Error()
+	}
+
+	if err := os.MkdirAll(bossDir(), 0700); err != nil {
+		return
+	}
+	f, err := os.OpenFile(bossFile(historyFile), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	b, _ := json.Marshal(h)
+	f.Write(append(b, '\n'))
+}
+
+// exit is os.Exit, for commands that are recorded in the history.
+func exit(code int) {
+	endHistory(code, nil)
+	os.Exit(code)
+}
+
+// redactArgs keeps passwords, parameters and context values out of the
+// history, since any of them could be secret.  Parameter files (@file)
+// and the keys of --set and --context are kept, to show what changed.
+func redactArgs(args []string) []string {
+	out := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		flag, value, inline := strings.Cut(a, "=")
+		if !inline {
+			if i+1 >= len(args) {
+				out = append(out, a)
+				continue
+			}
+			value = args[i+1]
+		}
+
+		var kept string
+		switch flag {
+		case "-p", "--password":
+			kept = redacted
+		case "-c", "--params":
+			kept = value
+			if !strings.HasPrefix(value, "@") {
+				kept = redacted
+			}
+		case "--set", "--context":
+			key, _, _ := strings.Cut(value, "=")
+			kept = key + "=" + redacted
+		default:
+			out = append(out, a)
+			continue
+		}
+
+		if inline {
+			out = append(out, flag+"="+kept)
+		} else {
+			out = append(out, flag, kept)
+			i++
+		}
+	}
+	return out
+}
+
+// ReadHistory reads every entry from the history file, oldest first.
+func ReadHistory() ([]HistoryEntry, error) {
+	l := make([]HistoryEntry, 0)
+	f, err := os.Open(bossFile(historyFile))
+	if os.IsNotExist(err) {
+		return l, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	s.Buffer(make([]byte, 64*1024), 1024*1024)
+	for s.Scan() {
+		var h HistoryEntry
+		if json.Unmarshal(s.Bytes(), &h) != nil {
+			continue /* a torn write; skip it */
+		}
+		l = append(l, h)
+	}
+	return l, s.Err()
+}
+
+// ReplayArgs are the arguments to re-run an entry with, against the
+// same target (unless the original said otherwise).
+func (h HistoryEntry) ReplayArgs() []string {
+	args := make([]string, 0, len(h.Args)+2)
+	targeted := false
+	for i := 0; i < len(h.Args); i++ {
+		a := h.Args[i]
+		if a == "-U" || a == "--url" || strings.HasPrefix(a, "--url=") {
+			targeted = true
+		}
+		/* passwords weren't kept; let the config or the environment
+		   supply them again */
+		if (a == "-p" || a == "--password") && i+1 < len(h.Args) && h.Args[i+1] == redacted {
+			i++
+			continue
+		}
+		if a == "--password="+redacted {
+			continue
+		}
+		args = append(args, a)
+	}
+	if !targeted && h.Target != "" {
+		args = append([]string{"-U", h.Target}, args...)
+	}
+	return args
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	LogError = iota
+	LogWarn
+	LogInfo
+	LogDebug
+	LogTrace
+)
+
+var logLevels = []string{"error", "warn", "info", "debug", "trace"}
+
+func ParseLogLevel(s string) (int, error) {
+	for i, name := range logLevels {
+		if strings.EqualFold(s, name) {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("unrecognized log level '%s' (try one of %s)", s, strings.Join(logLevels, ", "))
+}
+
+type Logger struct {
+	Level int
+	JSON  bool
+	Out   io.Writer
+
+	lock sync.Mutex
+}
+
+func NewLogger(level int) *Logger {
+	return &Logger{Level: level, Out: os.Stderr}
+}
+
+func (l *Logger) Enabled(level int) bool {
+	return l != nil && level <= l.Level
+}
+
+func (l *Logger) log(level int, msg string, kv ...interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.JSON {
+		entry := map[string]interface{}{
+			"time":  time.Now().UTC().Format(time.RFC3339Nano),
+			"level": logLevels[level],
+			"msg":   msg,
+		}
+		for i := 0; i+1 < len(kv); i += 2 {
+			entry[fmt.Sprintf("%v", kv[i])] = kv[i+1]
+		}
+		b, err := json.Marshal(entry)
+		if err != nil {
+			return
+		}
+		fmt.Fprintf(l.Out, "%s\n", string(b))
+		return
+	}
+
+	line := fmt.Sprintf("%s> %s", strings.ToUpper(logLevels[level]), msg)
+	for i := 0; i+1 < len(kv); i += 2 {
+		line += fmt.Sprintf(" %v=%v", kv[i], kv[i+1])
+	}
+	fmt.Fprintf(l.Out, "%s\n", line)
+}
+
+func (l *Logger) Errorf(msg string, kv ...interface{}) { l.log(LogError, msg, kv...) }
+func (l *Logger) Warnf(msg string, kv ...interface{})  { l.log(LogWarn, msg, kv...) }
+func (l *Logger) Infof(msg string, kv ...interface{})  { l.log(LogInfo, msg, kv...) }
+func (l *Logger) Debugf(msg string, kv ...interface{}) { l.log(LogDebug, msg, kv...) }
+
+func (l *Logger) Dump(msg string, b []byte) {
+	if !l.Enabled(LogTrace) {
+		return
+	}
+
+	if l.JSON {
+		l.log(LogTrace, msg, "dump", string(b))
+		return
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	fmt.Fprintf(l.Out, "=================================\n")
+	fmt.Fprintf(l.Out, "%s\n\n", string(b))
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type Node struct {
+	Group string   `json:"instance_group"`
+	Index int      `json:"index"`
+	Jobs  []string `json:"jobs"`
+	IP    string   `json:"ip,omitempty"`
+	AZ    string   `json:"az,omitempty"`
+}
+
+func (n Node) String() string {
+	return fmt.Sprintf("%s/%d", n.Group, n.Index)
+}
+
+func asMap(v interface{}) map[string]interface{} {
+	m, _ := v.(map[string]interface{})
+	return m
+}
+
+func asList(v interface{}) []interface{} {
+	l, _ := v.([]interface{})
+	return l
+}
+
+func asString(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+func asInt(v interface{}) int {
+	switch n := v.(type) {
+	case int:
+		return n
+	case int64:
+		return int(n)
+	case float64:
+		return int(n)
+	case string:
+		i, _ := strconv.Atoi(n)
+		return i
+	}
+	return 0
+}
+
+func ParseNodes(manifest string) ([]Node, error) {
+	v, err := parseYAML(manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	m := asMap(v)
+	if m == nil {
+		return nil, fmt.Errorf("deployment manifest is not a YAML map")
+	}
+
+	nodes := make([]Node, 0)
+	for _, g := range asList(m["instance_groups"]) {
+		group := asMap(g)
+		if group == nil {
+			continue
+		}
+
+		jobs := make([]string, 0)
+		for _, j := range asList(group["jobs"]) {
+			if name := asString(asMap(j)["name"]); name != "" {
+				jobs = append(jobs, name)
+			}
+		}
+
+		var ips []string
+		for _, n := range asList(group["networks"]) {
+			for _, ip := range asList(asMap(n)["static_ips"]) {
+				ips = append(ips, asString(ip))
+			}
+		}
+
+		var azs []string
+		for _, az := range asList(group["azs"]) {
+			azs = append(azs, asString(az))
+		}
+
+		for i := 0; i < asInt(group["instances"]); i++ {
+			node := Node{
+				Group: asString(group["name"]),
+				Index: i,
+				Jobs:  jobs,
+			}
+			if i < len(ips) {
+				node.IP = ips[i]
+			}
+			if len(azs) > 0 {
+				node.AZ = azs[i%len(azs)]
+			}
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes, nil
+}
+
+// SelectNodes picks out the nodes matching a target spec, which is
+// either an instance group name (`haproxy`), or a group and index
+// (`rabbitmq/1`).  An empty spec selects every node.
+func SelectNodes(nodes []Node, spec string) ([]Node, error) {
+	if spec == "" {
+		return nodes, nil
+	}
+
+	group, index := spec, -1
+	if i := strings.LastIndex(spec, "/"); i >= 0 {
+		n, err := strconv.Atoi(spec[i+1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid node `%s' (expected group or group/index)", spec)
+		}
+		group, index = spec[:i], n
+	}
+
+	selected := make([]Node, 0)
+	for _, node := range nodes {
+		if node.Group == group && (index < 0 || node.Index == index) {
+			selected = append(selected, node)
+		}
+	}
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("no nodes found matching `%s'", spec)
+	}
+	return selected, nil
+}
+
+type InvalidManifestError struct {
+	ID       string
+	Problems []string
+}
+
+func (e InvalidManifestError) Error() string {
+	return fmt.Sprintf("deployment manifest for instance `%s' looks broken: %s", e.ID, strings.Join(e.Problems, "; "))
+}
+
+// CheckManifest looks for the signs of an empty, truncated or
+// otherwise corrupt manifest.  If the manifest can't be parsed, that
+// is returned as an error, rather than as a problem: boss's YAML
+// reader isn't BOSH's, so that alone isn't reason enough to stop.
+func CheckManifest(manifest string) ([]string, error) {
+	if strings.TrimSpace(manifest) == "" {
+		return []string{"manifest is empty"}, nil
+	}
+	v, err := parseYAML(manifest)
+	if err != nil {
+		return nil, err
+	}
+	m := asMap(v)
+	if m == nil {
+		return []string{"manifest is not a YAML map"}, nil
+	}
+
+	problems := make([]string, 0)
+	if asString(m["name"]) == "" {
+		problems = append(problems, "missing deployment `name'")
+	}
+	for _, key := range []string{"releases", "stemcells", "instance_groups"} {
+		if len(asList(m[key])) == 0 {
+			problems = append(problems, fmt.Sprintf("missing (or empty) `%s'", key))
+		}
+	}
+	for i, r := range asList(m["releases"]) {
+		if asString(asMap(r)["name"]) == "" || asString(asMap(r)["version"]) == "" {
+			problems = append(problems, fmt.Sprintf("release #%d has no name or version", i+1))
+		}
+	}
+	for i, g := range asList(m["instance_groups"]) {
+		group := asMap(g)
+		name := asString(group["name"])
+		if name == "" {
+			problems = append(problems, fmt.Sprintf("instance group #%d has no name", i+1))
+			name = fmt.Sprintf("#%d", i+1)
+		}
+		if len(asList(group["jobs"])) == 0 {
+			problems = append(problems, fmt.Sprintf("instance group %s has no jobs", name))
+		}
+		if len(asList(group["networks"])) == 0 {
+			problems = append(problems, fmt.Sprintf("instance group %s has no networks", name))
+		}
+	}
+	return problems, nil
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metrics receives an observation for every request a Client sends
+// (including each retry), so that embedders can feed them into
+// Prometheus, StatsD, or whatever else they use.
+type Metrics interface {
+	ObserveRequest(method, endpoint, class string, status int, elapsed time.Duration)
+	ObserveRetry(method, endpoint, reason string)
+}
+
+// errorClass buckets a response (or transport failure) into one
+// of a handful of low-cardinality labels.
+func errorClass(status int, err error) string {
+	switch {
+	case err != nil:
+		return "network"
+	case status == 429:
+		return "rate_limited"
+	case status == 401 || status == 403:
+		return "unauthorized"
+	case status >= 500:
+		return "server"
+	case status >= 400:
+		return "client"
+	}
+	return "ok"
+}
+
+// Route normalizes a request path into a route template, so that
+// per-endpoint metrics aren't labeled with every instance ID.
+func Route(path string) string {
+	if i := strings.IndexByte(path, '?'); i >= 0 {
+		path = path[:i]
+	}
+
+	l := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	switch {
+	case len(l) >= 2 && l[0] == "v2" && l[1] == "service_instances":
+		if len(l) >= 3 {
+			l[2] = ":id"
+		}
+		if len(l) >= 5 && l[3] == "service_bindings" {
+			l[4] = ":binding"
+		}
+	case len(l) >= 3 && l[0] == "b":
+		l[1] = ":id"
+	}
+	return "/" + strings.Join(l, "/")
+}
+
+func (c *Client) observe(method, path string, status int, err error, elapsed time.Duration) {
+	if c.Metrics != nil {
+		c.Metrics.ObserveRequest(method, Route(path), errorClass(status, err), status, elapsed)
+	}
+}
+
+func (c *Client) retried(method, path, reason string) {
+	if c.Metrics != nil {
+		c.Metrics.ObserveRetry(method, Route(path), reason)
+	}
+}
+
+type metricKey struct {
+	method   string
+	endpoint string
+	label    string
+}
+
+type latency struct {
+	count int64
+	sum   time.Duration
+}
+
+// MetricsRecorder is a ready-made Metrics implementation that keeps
+// counters in memory and renders them in the Prometheus text format,
+// i.e. for serving from a /metrics handler or wrapping in a collector.
+type MetricsRecorder struct {
+	lock     sync.Mutex
+	requests map[metricKey]int64
+	retries  map[metricKey]int64
+	latency  map[metricKey]*latency
+}
+
+func NewMetricsRecorder() *MetricsRecorder {
+	return &MetricsRecorder{
+		requests: make(map[metricKey]int64),
+		retries:  make(map[metricKey]int64),
+		latency:  make(map[metricKey]*latency),
+	}
+}
+
+func (m *MetricsRecorder) ObserveRequest(method, endpoint, class string, status int, elapsed time.Duration) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.requests[metricKey{method, endpoint, class}]++
+
+	k := metricKey{method: method, endpoint: endpoint}
+	if m.latency[k] == nil {
+		m.latency[k] = &latency{}
+	}
+	m.latency[k].count++
+	m.latency[k].sum += elapsed
+}
+
+func (m *MetricsRecorder) ObserveRetry(method, endpoint, reason string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.retries[metricKey{method, endpoint, reason}]++
+}
+
+func sortedKeys(m map[metricKey]int64) []metricKey {
+	keys := make([]metricKey, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].endpoint != keys[j].endpoint {
+			return keys[i].endpoint < keys[j].endpoint
+		}
+		if keys[i].method != keys[j].method {
+			return keys[i].method < keys[j].method
+		}
+		return keys[i].label < keys[j].label
+	})
+	return keys
+}
+
+func (m *MetricsRecorder) WritePrometheus(w io.Writer) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	var b strings.Builder
+	b.WriteString("# HELP blacksmith_client_requests_total Requests sent to the Blacksmith broker.\n")
+	b.WriteString("# TYPE blacksmith_client_requests_total counter\n")
+	for _, k := range sortedKeys(m.requests) {
+		fmt.Fprintf(&b, "blacksmith_client_requests_total{method=%q,endpoint=%q,class=%q} %d\n", k.method, k.endpoint, k.label, m.requests[k])
+	}
+
+	b.WriteString("# HELP blacksmith_client_retries_total Requests retried against the Blacksmith broker.\n")
+	b.WriteString("# TYPE blacksmith_client_retries_total counter\n")
+	for _, k := range sortedKeys(m.retries) {
+		fmt.Fprintf(&b, "blacksmith_client_retries_total{method=%q,endpoint=%q,reason=%q} %d\n", k.method, k.endpoint, k.label, m.retries[k])
+	}
+
+	counts := make(map[metricKey]int64)
+	for k, l := range m.latency {
+		counts[k] = l.count
+	}
+	b.WriteString("# HELP blacksmith_client_request_seconds Time spent waiting on the Blacksmith broker.\n")
+	b.WriteString("# TYPE blacksmith_client_request_seconds summary\n")
+	for _, k := range sortedKeys(counts) {
+		l := m.latency[k]
+		fmt.Fprintf(&b, "blacksmith_client_request_seconds_sum{method=%q,endpoint=%q} %g\n", k.method, k.endpoint, l.sum.Seconds())
+		fmt.Fprintf(&b, "blacksmith_client_request_seconds_count{method=%q,endpoint=%q} %d\n", k.method, k.endpoint, l.count)
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"net/http"
+)
+
+// Middleware wraps the RoundTripper that a Client uses to talk to
+// Blacksmith, to add auth schemes, auditing, metrics and the like.
+type Middleware func(http.RoundTripper) http.RoundTripper
+
+// RoundTripperFunc adapts an ordinary function into a RoundTripper.
+type RoundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f RoundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// Use appends middleware to the Client.  It must be called before
+// the Client makes its first request.
+func (c *Client) Use(m ...Middleware) {
+	c.Middleware = append(c.Middleware, m...)
+}
+
+// wrap applies middleware so that the first one given is the
+// outermost, and sees each request first (and each response last).
+func (c *Client) wrap(rt http.RoundTripper) http.RoundTripper {
+	for i := len(c.Middleware) - 1; i >= 0; i-- {
+		rt = c.Middleware[i](rt)
+	}
+	return rt
+}
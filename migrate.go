@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// ChangePlan moves an instance to another plan of its service, as an
+// update that changes nothing else.
+func (c *Client) ChangePlan(id, plan string) (Instance, error) {
+	return c.Update(id, ProvisionOptions{PlanID: plan})
+}
+
+func (c *Client) ChangePlanAndWait(id, plan string, timeout time.Duration) (Instance, error) {
+	return c.UpdateAndWait(id, ProvisionOptions{PlanID: plan}, timeout)
+}
+
+// CredsDrift compares two sets of instance credentials (as YAML), and
+// returns the (sorted) paths of every value that was added, removed
+// or changed between them.
+func CredsDrift(before, after string) ([]string, error) {
+	a, err := parseYAML(before)
+	if err != nil {
+		return nil, err
+	}
+	b, err := parseYAML(after)
+	if err != nil {
+		return nil, err
+	}
+
+	l := make([]string, 0)
+	drift("", a, b, &l)
+	sort.Strings(l)
+	return l, nil
+}
+
+func drift(path string, a, b interface{}, l *[]string) {
+	am, aok := a.(map[string]interface{})
+	bm, bok := b.(map[string]interface{})
+	if !aok || !bok {
+		if !reflect.DeepEqual(a, b) {
+			*l = append(*l, path)
+		}
+		return
+	}
+
+	for k, v := range am {
+		drift(fmt.Sprintf("%s.%s", path, k), v, bm[k], l)
+	}
+	for k, v := range bm {
+		if _, ok := am[k]; !ok {
+			drift(fmt.Sprintf("%s.%s", path, k), nil, v, l)
+		}
+	}
+}
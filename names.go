@@ -2,7 +2,9 @@ package main
 
 import (
 	"fmt"
+	"io/ioutil"
 	"math/rand"
+	"strings"
 )
 
 var (
@@ -342,8 +344,232 @@ var (
 		"yonath",
 		"zhukovsky",
 	}
+
+	animals = [...]string{
+		"aardvark",
+		"alpaca",
+		"anteater",
+		"armadillo",
+		"badger",
+		"beaver",
+		"bison",
+		"bobcat",
+		"buffalo",
+		"camel",
+		"caribou",
+		"cheetah",
+		"chipmunk",
+		"cougar",
+		"coyote",
+		"crane",
+		"dingo",
+		"dolphin",
+		"eagle",
+		"elk",
+		"falcon",
+		"ferret",
+		"flamingo",
+		"fox",
+		"gazelle",
+		"gecko",
+		"gibbon",
+		"giraffe",
+		"gopher",
+		"heron",
+		"hippo",
+		"ibex",
+		"iguana",
+		"impala",
+		"jackal",
+		"jaguar",
+		"kestrel",
+		"koala",
+		"lemur",
+		"leopard",
+		"llama",
+		"lynx",
+		"magpie",
+		"manatee",
+		"marmot",
+		"meerkat",
+		"mongoose",
+		"moose",
+		"narwhal",
+		"ocelot",
+		"octopus",
+		"okapi",
+		"opossum",
+		"orca",
+		"osprey",
+		"otter",
+		"owl",
+		"panda",
+		"pelican",
+		"penguin",
+		"puffin",
+		"quokka",
+		"raccoon",
+		"raven",
+		"salamander",
+		"seal",
+		"sloth",
+		"stoat",
+		"swan",
+		"tapir",
+		"tiger",
+		"toucan",
+		"walrus",
+		"weasel",
+		"wolf",
+		"wombat",
+		"yak",
+		"zebra",
+	}
 )
 
+type NameOptions struct {
+	Words     int
+	Separator string
+	Charset   string
+	Taken     func(string) bool
+
+	Prefix    string /* i.e. team-env, joined to the name with Separator */
+	Wordlist  string /* scientists (the default), animals, or a file of words */
+	MaxLength int    /* 0 for no limit */
+}
+
+// wordlists returns the words to draw the leading (adjective) and
+// final words of a name from.  A wordlist file has one word per line,
+// all of which are drawn from for every word of the name.
+func (o NameOptions) wordlists() ([]string, []string, error) {
+	switch o.Wordlist {
+	case "", "scientists":
+		return left[:], right[:], nil
+	case "animals":
+		return left[:], animals[:], nil
+	}
+
+	b, err := ioutil.ReadFile(o.Wordlist)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unrecognized word list '%s' (try scientists, animals, or a file of words): %s", o.Wordlist, err)
+	}
+	words := make([]string, 0)
+	for _, line := range strings.Split(string(b), "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+			words = append(words, line)
+		}
+	}
+	if len(words) == 0 {
+		return nil, nil, fmt.Errorf("word list %s has no words in it", o.Wordlist)
+	}
+	return words, words, nil
+}
+
+// NameGenerator makes up instance names.  Seeded generators make the
+// same names in the same order every time, which is handy for tests
+// and for reproducing naming schemes.
+type NameGenerator struct {
+	rand *rand.Rand
+}
+
+func NewNameGenerator(seed int64) *NameGenerator {
+	return &NameGenerator{rand: rand.New(rand.NewSource(seed))}
+}
+
+/* the zero generator draws from math/rand's global source */
+var defaultNames = &NameGenerator{}
+
+func (g *NameGenerator) intn(n int) int {
+	if g.rand == nil {
+		return rand.Intn(n)
+	}
+	return g.rand.Intn(n)
+}
+
+func (g *NameGenerator) generate(o NameOptions, first, last []string) string {
+	if o.Words <= 0 {
+		o.Words = 2
+	}
+	if o.Separator == "" {
+		o.Separator = "-"
+	}
+
+	words := make([]string, o.Words)
+	for i := 0; i < o.Words-1; i++ {
+		words[i] = first[g.intn(len(first))]
+	}
+	words[o.Words-1] = last[g.intn(len(last))]
+
+	name := strings.Join(words, o.Separator)
+	if o.Prefix != "" {
+		name = strings.TrimSuffix(o.Prefix, o.Separator) + o.Separator + name
+	}
+	if o.Charset != "" {
+		name = strings.Map(func(r rune) rune {
+			if strings.ContainsRune(o.Charset, r) {
+				return r
+			}
+			return -1
+		}, name)
+	}
+	return name
+}
+
+func (g *NameGenerator) Generate(o NameOptions) (string, error) {
+	first, last, err := o.wordlists()
+	if err != nil {
+		return "", err
+	}
+	return g.generate(o, first, last), nil
+}
+
+// Unique generates names until it finds one that isn't taken, and
+// fits in MaxLength (if set), giving up after a while.
+func (g *NameGenerator) Unique(o NameOptions) (string, error) {
+	first, last, err := o.wordlists()
+	if err != nil {
+		return "", err
+	}
+	for i := 0; i < 100; i++ {
+		name := g.generate(o, first, last)
+		if name == "" || o.MaxLength > 0 && len(name) > o.MaxLength {
+			continue
+		}
+		if o.Taken == nil || !o.Taken(name) {
+			return name, nil
+		}
+	}
+	if o.MaxLength > 0 {
+		return "", fmt.Errorf("unable to generate a unique instance name of %d characters or less", o.MaxLength)
+	}
+	return "", fmt.Errorf("unable to generate a unique instance name")
+}
+
 func RandomName() string {
-	return fmt.Sprintf("%s-%s", left[rand.Intn(len(left))], right[rand.Intn(len(right))])
+	return GenerateName(NameOptions{})
+}
+
+func GenerateName(o NameOptions) string {
+	name, _ := defaultNames.Generate(o)
+	return name
+}
+
+func UniqueName(o NameOptions) (string, error) {
+	return defaultNames.Unique(o)
+}
+
+func (c *Client) RandomName(o NameOptions) (string, error) {
+	out, err := c.status()
+	if err != nil {
+		return "", err
+	}
+
+	taken := o.Taken
+	o.Taken = func(name string) bool {
+		if _, ok := out.Instances[name]; ok {
+			return true
+		}
+		return taken != nil && taken(name)
+	}
+	return UniqueName(o)
 }
@@ -0,0 +1,365 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// PatchOp is one operation from a BOSH ops file.  Like go-patch,
+// paths look like /instance_groups/name=redis/vm_type, where a
+// trailing ? makes that step (and all after it) optional, and a
+// final - appends to an array.  Values are kept as YAML nodes, so
+// that they go into the manifest written exactly as they were in the
+// ops file (quoted strings stay quoted, and so on).
+type PatchOp struct {
+	Type  string
+	Path  string
+	Value *yaml.Node
+}
+
+type patchToken struct {
+	key      string
+	index    int
+	isIndex  bool
+	isAppend bool
+	isMatch  bool
+	matchKey string
+	matchVal string
+	optional bool
+}
+
+func ReadOpsFile(path string) ([]PatchOp, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	ops, err := ParseOpsFile(string(b))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return ops, nil
+}
+
+func ParseOpsFile(src string) ([]PatchOp, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(src), &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 {
+		return nil, nil
+	}
+	l := unalias(doc.Content[0])
+	if l.Kind != yaml.SequenceNode {
+		return nil, fmt.Errorf("ops file must be a list of operations")
+	}
+
+	ops := make([]PatchOp, 0, len(l.Content))
+	for i, raw := range l.Content {
+		m := unalias(raw)
+		if m.Kind != yaml.MappingNode {
+			return nil, fmt.Errorf("operation #%d is not a map", i+1)
+		}
+		op := PatchOp{}
+		if n := mapValue(m, "type"); n != nil {
+			op.Type = n.Value
+		}
+		if n := mapValue(m, "path"); n != nil {
+			op.Path = n.Value
+		}
+		op.Value = mapValue(m, "value")
+		if op.Type != "replace" && op.Type != "remove" {
+			return nil, fmt.Errorf("operation #%d: unsupported type '%s' (expected replace or remove)", i+1, op.Type)
+		}
+		if _, err := parsePatchPath(op.Path); err != nil {
+			return nil, fmt.Errorf("operation #%d: %s", i+1, err)
+		}
+		ops = append(ops, op)
+	}
+	return ops, nil
+}
+
+func parsePatchPath(path string) ([]patchToken, error) {
+	if !strings.HasPrefix(path, "/") || path == "/" {
+		return nil, fmt.Errorf("invalid path '%s' (must start with /)", path)
+	}
+
+	toks := make([]patchToken, 0)
+	for _, s := range strings.Split(path[1:], "/") {
+		t := patchToken{}
+		if strings.HasSuffix(s, "?") {
+			t.optional = true
+			s = strings.TrimSuffix(s, "?")
+		}
+		s = strings.NewReplacer("~1", "/", "~0", "~").Replace(s)
+
+		if s == "-" {
+			t.isAppend = true
+		} else if i, err := strconv.Atoi(s); err == nil {
+			t.isIndex, t.index = true, i
+		} else if l := strings.SplitN(s, "=", 2); len(l) == 2 {
+			t.isMatch, t.matchKey, t.matchVal = true, l[0], l[1]
+		} else {
+			t.key = s
+		}
+		toks = append(toks, t)
+	}
+	return toks, nil
+}
+
+// ApplyOps patches a YAML document in place.  It works on the
+// document's nodes, rather than on the values they decode to, so that
+// everything the ops don't touch is written back out as it was:
+// quoting, anchors, aliases, comments and all.
+func ApplyOps(doc *yaml.Node, ops []PatchOp) error {
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 {
+		return fmt.Errorf("document is empty")
+	}
+	for _, op := range ops {
+		toks, err := parsePatchPath(op.Path)
+		if err != nil {
+			return err
+		}
+		root, err := patch(doc.Content[0], toks, op, false)
+		if err != nil {
+			return fmt.Errorf("%s %s: %s", op.Type, op.Path, err)
+		}
+		doc.Content[0] = root
+	}
+	return nil
+}
+
+// RedeployPatched redeploys an instance from its saved manifest,
+// after applying the given ops to it.  Unless SkipManifestCheck is
+// set, it refuses to redeploy from a manifest that looks broken.
+func (c *Client) RedeployPatched(id string, ops []PatchOp) (string, error) {
+	if len(ops) == 0 && c.SkipManifestCheck {
+		return c.Redeploy(id)
+	}
+
+	manifest, err := c.Manifest(id)
+	if err != nil {
+		return "", err
+	}
+	if err := c.checkManifest(id, manifest); err != nil {
+		return "", err
+	}
+	if len(ops) == 0 {
+		return c.Redeploy(id)
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(manifest), &doc); err != nil {
+		return "", err
+	}
+	if err := ApplyOps(&doc, ops); err != nil {
+		return "", err
+	}
+	manifest, err = marshalNode(&doc)
+	if err != nil {
+		return "", err
+	}
+	if err := c.checkManifest(id, manifest); err != nil {
+		return "", err
+	}
+	return c.RedeployWith(id, manifest)
+}
+
+func (c *Client) checkManifest(id, manifest string) error {
+	if c.SkipManifestCheck {
+		return nil
+	}
+	problems, err := CheckManifest(manifest)
+	if err != nil {
+		c.Logger.Warnf("unable to check deployment manifest", "instance", id, "error", err)
+		return nil
+	}
+	if len(problems) > 0 {
+		return InvalidManifestError{ID: id, Problems: problems}
+	}
+	return nil
+}
+
+/* aliases are followed for reading; see expand for writing */
+func unalias(n *yaml.Node) *yaml.Node {
+	for n != nil && n.Kind == yaml.AliasNode {
+		n = n.Alias
+	}
+	return n
+}
+
+// expand replaces an alias with a copy of what it refers to, before
+// it is patched, so that a change made through one alias doesn't also
+// change the anchor (and every other alias of it).
+func expand(n *yaml.Node) *yaml.Node {
+	if n == nil || n.Kind != yaml.AliasNode {
+		return n
+	}
+	cp := copyNode(unalias(n))
+	cp.Anchor = ""
+	return cp
+}
+
+func copyNode(n *yaml.Node) *yaml.Node {
+	if n == nil {
+		return nil
+	}
+	cp := *n
+	cp.Content = make([]*yaml.Node, len(n.Content))
+	for i, child := range n.Content {
+		cp.Content[i] = copyNode(child)
+	}
+	return &cp
+}
+
+func isNull(n *yaml.Node) bool {
+	n = unalias(n)
+	return n == nil || (n.Kind == yaml.ScalarNode && n.ShortTag() == "!!null")
+}
+
+func mapValue(m *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return m.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func scalarNode(s string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: s}
+}
+
+/* each use of an op's value gets its own copy of it */
+func opValue(op PatchOp) *yaml.Node {
+	if op.Value == nil {
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null", Value: "null"}
+	}
+	return copyNode(op.Value)
+}
+
+func patch(node *yaml.Node, toks []patchToken, op PatchOp, optional bool) (*yaml.Node, error) {
+	t := toks[0]
+	optional = optional || t.optional
+	last := len(toks) == 1
+	node = expand(node)
+
+	if t.isAppend || t.isIndex || t.isMatch {
+		if node == nil || node.Kind != yaml.SequenceNode {
+			if !isNull(node) || !optional {
+				return nil, fmt.Errorf("expected an array")
+			}
+			node = &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		}
+		list := node.Content
+
+		if t.isAppend {
+			if !last || op.Type != "replace" {
+				return nil, fmt.Errorf("'-' can only end the path of a replace")
+			}
+			node.Content = append(list, opValue(op))
+			return node, nil
+		}
+
+		i := -1
+		if t.isIndex {
+			i = t.index
+			if i < 0 {
+				i += len(list)
+			}
+			if i < 0 || i >= len(list) {
+				return nil, fmt.Errorf("array index %d out of range (%d elements)", t.index, len(list))
+			}
+		} else {
+			for j, v := range list {
+				if v := unalias(v); v.Kind == yaml.MappingNode {
+					if k := unalias(mapValue(v, t.matchKey)); k != nil && k.Kind == yaml.ScalarNode && k.Value == t.matchVal {
+						i = j
+						break
+					}
+				}
+			}
+			if i < 0 {
+				switch {
+				case !optional:
+					return nil, fmt.Errorf("no array element with %s=%s", t.matchKey, t.matchVal)
+				case op.Type == "remove":
+					return node, nil
+				case last:
+					node.Content = append(list, opValue(op))
+					return node, nil
+				}
+				list = append(list, &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map",
+					Content: []*yaml.Node{scalarNode(t.matchKey), scalarNode(t.matchVal)}})
+				i = len(list) - 1
+			}
+		}
+
+		if last {
+			if op.Type == "remove" {
+				node.Content = append(list[:i:i], list[i+1:]...)
+				return node, nil
+			}
+			list[i] = opValue(op)
+			node.Content = list
+			return node, nil
+		}
+		child, err := patch(list[i], toks[1:], op, optional)
+		if err != nil {
+			return nil, err
+		}
+		list[i] = child
+		node.Content = list
+		return node, nil
+	}
+
+	if node == nil || node.Kind != yaml.MappingNode {
+		if !isNull(node) || !optional {
+			return nil, fmt.Errorf("expected a map to find key '%s' in", t.key)
+		}
+		node = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	}
+
+	at := -1
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == t.key {
+			at = i + 1
+		}
+	}
+	if at < 0 && !optional {
+		return nil, fmt.Errorf("no map key '%s'", t.key)
+	}
+	if last {
+		switch {
+		case op.Type == "remove" && at >= 0:
+			node.Content = append(node.Content[:at-1:at-1], node.Content[at+1:]...)
+		case op.Type == "remove":
+		case at >= 0:
+			node.Content[at] = opValue(op)
+		default:
+			node.Content = append(node.Content, scalarNode(t.key), opValue(op))
+		}
+		return node, nil
+	}
+	if at < 0 && op.Type == "remove" {
+		return node, nil
+	}
+
+	var child *yaml.Node
+	if at >= 0 {
+		child = node.Content[at]
+	}
+	child, err := patch(child, toks[1:], op, optional)
+	if err != nil {
+		return nil, err
+	}
+	if at >= 0 {
+		node.Content[at] = child
+	} else {
+		node.Content = append(node.Content, scalarNode(t.key), child)
+	}
+	return node, nil
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func patched(t *testing.T, manifest, ops string) string {
+	t.Helper()
+	l, err := ParseOpsFile(ops)
+	if err != nil {
+		t.Fatalf("unable to parse ops: %s", err)
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(manifest), &doc); err != nil {
+		t.Fatalf("unable to parse manifest: %s", err)
+	}
+	if err := ApplyOps(&doc, l); err != nil {
+		t.Fatalf("unable to apply ops: %s", err)
+	}
+	out, err := marshalNode(&doc)
+	if err != nil {
+		t.Fatalf("unable to write manifest: %s", err)
+	}
+	return out
+}
+
+func TestApplyOpsKeepsUntouchedValuesAsWritten(t *testing.T) {
+	manifest := `name: redis
+properties: &props
+  appendonly: "yes"
+  port: "0123"
+  tls: "on"
+instance_groups:
+- name: redis
+  vm_type: small
+  properties: *props
+`
+	out := patched(t, manifest, `
+- type: replace
+  path: /instance_groups/name=redis/vm_type
+  value: large
+`)
+	for _, want := range []string{
+		`appendonly: "yes"`,
+		`port: "0123"`,
+		`tls: "on"`,
+		`&props`,
+		`properties: *props`,
+		`vm_type: large`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("patched manifest is missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestApplyOpsKeepsQuotedValues(t *testing.T) {
+	out := patched(t, "name: redis\nproperties: {}\n", `
+- type: replace
+  path: /properties/appendonly?
+  value: "yes"
+`)
+	v, err := parseYAML(out)
+	if err != nil {
+		t.Fatalf("unable to read back patched manifest: %s", err)
+	}
+	if got := asMap(asMap(v)["properties"])["appendonly"]; got != "yes" {
+		t.Errorf("appendonly came back as %#v:\n%s", got, out)
+	}
+}
+
+func TestApplyOpsThroughAliasLeavesAnchorAlone(t *testing.T) {
+	out := patched(t, "a: &x {k: v}\nb: *x\n", `
+- type: replace
+  path: /b/k
+  value: changed
+`)
+	v, err := parseYAML(out)
+	if err != nil {
+		t.Fatalf("unable to read back patched manifest: %s", err)
+	}
+	if got := asMap(asMap(v)["a"])["k"]; got != "v" {
+		t.Errorf("a.k came back as %#v:\n%s", got, out)
+	}
+	if got := asMap(asMap(v)["b"])["k"]; got != "changed" {
+		t.Errorf("b.k came back as %#v:\n%s", got, out)
+	}
+}
+
+func TestApplyOps(t *testing.T) {
+	manifest := "instance_groups:\n- name: a\n  jobs: []\n- name: b\n  jobs: []\n"
+	tests := []struct {
+		ops  string
+		want interface{}
+	}{
+		{"- {type: remove, path: '/instance_groups/name=a'}", []interface{}{
+			map[string]interface{}{"name": "b", "jobs": []interface{}{}},
+		}},
+		{"- {type: replace, path: '/instance_groups/-', value: {name: c}}", []interface{}{
+			map[string]interface{}{"name": "a", "jobs": []interface{}{}},
+			map[string]interface{}{"name": "b", "jobs": []interface{}{}},
+			map[string]interface{}{"name": "c"},
+		}},
+		{"- {type: replace, path: '/instance_groups/1/jobs/-', value: x}", []interface{}{
+			map[string]interface{}{"name": "a", "jobs": []interface{}{}},
+			map[string]interface{}{"name": "b", "jobs": []interface{}{"x"}},
+		}},
+		{"- {type: replace, path: '/instance_groups/name=c?/jobs', value: [y]}", []interface{}{
+			map[string]interface{}{"name": "a", "jobs": []interface{}{}},
+			map[string]interface{}{"name": "b", "jobs": []interface{}{}},
+			map[string]interface{}{"name": "c", "jobs": []interface{}{"y"}},
+		}},
+	}
+	for _, test := range tests {
+		v, err := parseYAML(patched(t, manifest, test.ops))
+		if err != nil {
+			t.Fatalf("%s: %s", test.ops, err)
+		}
+		if got := asMap(v)["instance_groups"]; !sameParam(got, test.want) {
+			t.Errorf("%s: got %#v, want %#v", test.ops, got, test.want)
+		}
+	}
+}
+
+func TestApplyOpsErrors(t *testing.T) {
+	for _, ops := range []string{
+		"- {type: replace, path: '/nope/x', value: 1}",
+		"- {type: remove, path: '/instance_groups/name=z'}",
+		"- {type: replace, path: '/instance_groups/5', value: 1}",
+	} {
+		l, err := ParseOpsFile(ops)
+		if err != nil {
+			t.Fatalf("%s: unable to parse: %s", ops, err)
+		}
+		var doc yaml.Node
+		yaml.Unmarshal([]byte("instance_groups: [{name: a}]\n"), &doc)
+		if err := ApplyOps(&doc, l); err == nil {
+			t.Errorf("%s: expected an error", ops)
+		}
+	}
+}
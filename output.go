@@ -0,0 +1,330 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+)
+
+/* JSON output is versioned; fields may be added to a schema
+   version, but never renamed or removed.  anything else requires
+   a new version, selectable via --output-schema. */
+
+var OutputSchemas = []string{"v1"}
+
+const DefaultOutputSchema = "v1"
+
+type RefV1 struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type InstanceV1 struct {
+	Broker             string                 `json:"broker,omitempty"`
+	ID                 string                 `json:"id"`
+	Name               string                 `json:"name,omitempty"`
+	Service            *RefV1                 `json:"service"`
+	Plan               *RefV1                 `json:"plan"`
+	DashboardURL       string                 `json:"dashboard_url,omitempty"`
+	MaintenanceVersion string                 `json:"maintenance_version,omitempty"`
+	Parameters         map[string]interface{} `json:"parameters,omitempty"`
+}
+
+type ListV1 struct {
+	Schema    string       `json:"schema"`
+	Instances []InstanceV1 `json:"instances"`
+}
+
+type ServiceV1 struct {
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Bindable    bool     `json:"bindable"`
+	Tags        []string `json:"tags"`
+	Plans       []RefV1  `json:"plans"`
+}
+
+type CatalogV1 struct {
+	Schema   string      `json:"schema"`
+	Services []ServiceV1 `json:"services"`
+}
+
+type InstanceDetailV1 struct {
+	Schema string `json:"schema"`
+	InstanceV1
+}
+
+type CredsV1 struct {
+	Schema      string      `json:"schema"`
+	Instance    string      `json:"instance"`
+	Credentials interface{} `json:"credentials"`
+}
+
+type BindingV1 struct {
+	Schema      string                 `json:"schema"`
+	Instance    string                 `json:"instance"`
+	Binding     string                 `json:"binding"`
+	Credentials map[string]interface{} `json:"credentials"`
+	Parameters  map[string]interface{} `json:"parameters,omitempty"`
+}
+
+/* log entries are emitted as JSON lines, one object per entry */
+type LogEntryV1 struct {
+	Timestamp string `json:"timestamp,omitempty"`
+	Level     string `json:"level,omitempty"`
+	Instance  string `json:"instance,omitempty"`
+	Message   string `json:"message"`
+}
+
+type QuotaV1 struct {
+	Service *RefV1 `json:"service"`
+	Plan    *RefV1 `json:"plan"`
+	Used    int    `json:"used"`
+	Limit   int    `json:"limit"` /* 0 means unlimited */
+}
+
+type QuotasV1 struct {
+	Schema string    `json:"schema"`
+	Quotas []QuotaV1 `json:"quotas"`
+}
+
+type PlanCapacityV1 struct {
+	Service   *RefV1 `json:"service"`
+	Plan      *RefV1 `json:"plan"`
+	Instances int    `json:"instances"`
+	Limit     int    `json:"limit"` /* 0 means unlimited */
+	VMs       int    `json:"vms_per_instance"`
+	DiskMB    int    `json:"disk_mb_per_vm"` /* 0 means unknown */
+	TotalVMs  int    `json:"total_vms"`
+	TotalDisk int    `json:"total_disk_mb"`
+}
+
+type CapacityV1 struct {
+	Schema    string           `json:"schema"`
+	Plans     []PlanCapacityV1 `json:"plans"`
+	TotalVMs  int              `json:"total_vms"`
+	TotalDisk int              `json:"total_disk_mb"`
+}
+
+var outputTypes = map[string]map[string]interface{}{
+	"v1": {
+		"list":     ListV1{},
+		"catalog":  CatalogV1{},
+		"instance": InstanceDetailV1{},
+		"creds":    CredsV1{},
+		"binding":  BindingV1{},
+		"quotas":   QuotasV1{},
+		"capacity": CapacityV1{},
+		"log":      LogEntryV1{},
+	},
+}
+
+func schemaName(kind, version string) string {
+	return fmt.Sprintf("boss/%s/%s", kind, version)
+}
+
+func CheckOutputSchema(version string) error {
+	for _, v := range OutputSchemas {
+		if v == version {
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported output schema '%s' (try one of %s)", version, strings.Join(OutputSchemas, ", "))
+}
+
+func ref(id, name string) *RefV1 {
+	return &RefV1{ID: id, Name: name}
+}
+
+func instanceV1(instance Instance) InstanceV1 {
+	out := InstanceV1{ID: instance.ID, Name: instance.Name, DashboardURL: instance.DashboardURL}
+	if instance.Service != nil {
+		out.Service = ref(instance.Service.ID, instance.Service.Name)
+	}
+	if instance.Plan != nil {
+		out.Plan = ref(instance.Plan.ID, instance.Plan.Name)
+	}
+	return out
+}
+
+func listV1(instances []Instance) ListV1 {
+	out := ListV1{
+		Schema:    schemaName("list", "v1"),
+		Instances: make([]InstanceV1, 0, len(instances)),
+	}
+	for _, instance := range instances {
+		out.Instances = append(out.Instances, instanceV1(instance))
+	}
+	return out
+}
+
+func catalogV1(catalog Catalog) CatalogV1 {
+	out := CatalogV1{
+		Schema:   schemaName("catalog", "v1"),
+		Services: make([]ServiceV1, 0, len(catalog.Services)),
+	}
+	for _, s := range catalog.Services {
+		svc := ServiceV1{
+			ID:          s.ID,
+			Name:        s.Name,
+			Description: s.Description,
+			Bindable:    s.Bindable,
+			Tags:        s.Tags,
+			Plans:       make([]RefV1, 0, len(s.Plans)),
+		}
+		if svc.Tags == nil {
+			svc.Tags = []string{}
+		}
+		for _, p := range s.Plans {
+			svc.Plans = append(svc.Plans, RefV1{ID: p.ID, Name: p.Name})
+		}
+		out.Services = append(out.Services, svc)
+	}
+	return out
+}
+
+func logEntryV1(e LogEntry) LogEntryV1 {
+	out := LogEntryV1{Level: e.Level, Instance: e.Instance, Message: e.Message}
+	if !e.Time.IsZero() {
+		out.Timestamp = e.Time.Format(time.RFC3339Nano)
+	}
+	return out
+}
+
+func quotasV1(quotas []Quota) QuotasV1 {
+	out := QuotasV1{
+		Schema: schemaName("quotas", "v1"),
+		Quotas: make([]QuotaV1, 0, len(quotas)),
+	}
+	for _, q := range quotas {
+		out.Quotas = append(out.Quotas, QuotaV1{
+			Service: ref(q.Service.ID, q.Service.Name),
+			Plan:    ref(q.Plan.ID, q.Plan.Name),
+			Used:    q.Used,
+			Limit:   q.Limit,
+		})
+	}
+	return out
+}
+
+func capacityV1(plans []Capacity) CapacityV1 {
+	out := CapacityV1{
+		Schema: schemaName("capacity", "v1"),
+		Plans:  make([]PlanCapacityV1, 0, len(plans)),
+	}
+	for _, p := range plans {
+		out.Plans = append(out.Plans, PlanCapacityV1{
+			Service:   ref(p.Service.ID, p.Service.Name),
+			Plan:      ref(p.Plan.ID, p.Plan.Name),
+			Instances: p.Used,
+			Limit:     p.Limit,
+			VMs:       p.VMs,
+			DiskMB:    p.DiskMB,
+			TotalVMs:  p.TotalVMs(),
+			TotalDisk: p.TotalDiskMB(),
+		})
+		out.TotalVMs += p.TotalVMs()
+		out.TotalDisk += p.TotalDiskMB()
+	}
+	return out
+}
+
+func credsV1(id, creds string) (CredsV1, error) {
+	v, err := parseYAML(creds)
+	if err != nil {
+		return CredsV1{}, err
+	}
+	return CredsV1{
+		Schema:      schemaName("creds", "v1"),
+		Instance:    id,
+		Credentials: v,
+	}, nil
+}
+
+func printJSON(v interface{}) {
+	b, err := json.MarshalIndent(v, "", "  ")
+	bail(err)
+	os.Stdout.Write(b)
+	os.Stdout.Write([]byte("\n"))
+}
+
+// JSONSchema derives a JSON Schema document for one of
+// the versioned output types, via its json struct tags.
+func JSONSchema(kind, version string) (map[string]interface{}, error) {
+	types, ok := outputTypes[version]
+	if !ok {
+		return nil, CheckOutputSchema(version)
+	}
+	v, ok := types[kind]
+	if !ok {
+		return nil, fmt.Errorf("no output schema for '%s'", kind)
+	}
+
+	schema := jsonSchemaOf(reflect.TypeOf(v))
+	schema["$schema"] = "http://json-schema.org/draft-07/schema#"
+	schema["$id"] = schemaName(kind, version)
+	return schema, nil
+}
+
+func jsonSchemaOf(t reflect.Type) map[string]interface{} {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return jsonSchemaOf(t.Elem())
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice:
+		return map[string]interface{}{"type": "array", "items": jsonSchemaOf(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object"}
+	case reflect.Struct:
+		props := make(map[string]interface{})
+		required := make([]string, 0)
+		jsonSchemaFields(t, props, &required)
+		return map[string]interface{}{
+			"type":       "object",
+			"properties": props,
+			"required":   required,
+		}
+	}
+	return map[string]interface{}{}
+}
+
+func jsonSchemaFields(t reflect.Type, props map[string]interface{}, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous {
+			jsonSchemaFields(f.Type, props, required)
+			continue
+		}
+
+		tag := strings.Split(f.Tag.Get("json"), ",")
+		if tag[0] == "" || tag[0] == "-" {
+			continue
+		}
+
+		s := jsonSchemaOf(f.Type)
+		if f.Type.Kind() == reflect.Ptr {
+			s = map[string]interface{}{"oneOf": []interface{}{s, map[string]interface{}{"type": "null"}}}
+		}
+		props[tag[0]] = s
+
+		omit := false
+		for _, o := range tag[1:] {
+			if o == "omitempty" {
+				omit = true
+			}
+		}
+		if !omit {
+			*required = append(*required, tag[0])
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+const pinsFile = "pins.json"
+
+type CatalogPin struct {
+	Hash  string   `json:"hash"`
+	Plans []string `json:"plans"`
+}
+
+func catalogPlans(catalog Catalog) []string {
+	plans := make([]string, 0)
+	for _, s := range catalog.Services {
+		for _, p := range s.Plans {
+			plans = append(plans, fmt.Sprintf("%s/%s %s/%s", s.Name, p.Name, s.ID, p.ID))
+		}
+	}
+	sort.Strings(plans)
+	return plans
+}
+
+func PinCatalog(catalog Catalog) CatalogPin {
+	plans := catalogPlans(catalog)
+	b, _ := json.Marshal(plans)
+	sum := sha256.Sum256(b)
+	return CatalogPin{
+		Hash:  hex.EncodeToString(sum[:]),
+		Plans: plans,
+	}
+}
+
+func readPins() (map[string]CatalogPin, error) {
+	pins := make(map[string]CatalogPin)
+	err := readState(pinsFile, &pins)
+	return pins, err
+}
+
+func SavePin(target string, pin *CatalogPin) error {
+	pins, err := readPins()
+	if err != nil {
+		return err
+	}
+	if pin == nil {
+		delete(pins, target)
+	} else {
+		pins[target] = *pin
+	}
+	return writeState(pinsFile, pins)
+}
+
+type CatalogChangedError struct {
+	Target  string
+	Added   []string
+	Removed []string
+}
+
+func (e CatalogChangedError) Error() string {
+	return fmt.Sprintf("catalog for %s has changed since it was pinned (%d plans added, %d removed)", e.Target, len(e.Added), len(e.Removed))
+}
+
+func VerifyPin(target string, catalog Catalog) error {
+	pins, err := readPins()
+	if err != nil {
+		return err
+	}
+	pin, ok := pins[target]
+	if !ok {
+		return nil
+	}
+
+	now := PinCatalog(catalog)
+	if now.Hash == pin.Hash {
+		return nil
+	}
+
+	was := make(map[string]bool)
+	for _, p := range pin.Plans {
+		was[p] = true
+	}
+	e := CatalogChangedError{Target: target}
+	for _, p := range now.Plans {
+		if !was[p] {
+			e.Added = append(e.Added, p)
+		}
+		delete(was, p)
+	}
+	for p := range was {
+		e.Removed = append(e.Removed, p)
+	}
+	sort.Strings(e.Removed)
+	return e
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jhunt/boss/ansi"
+)
+
+/* a small worker pool for bulk operations (bulk delete, fleet
+   redeploys, multi-target fan-out, ...) that retries failed items,
+   collects per-item errors, and reports progress as it goes. */
+
+type Job struct {
+	Name string
+	Run  func() error
+}
+
+type JobResult struct {
+	Name     string        `json:"name"`
+	State    string        `json:"state"`
+	Attempts int           `json:"attempts"`
+	Error    string        `json:"error,omitempty"`
+	Elapsed  time.Duration `json:"-"`
+
+	err error
+}
+
+type Pool struct {
+	Parallel int
+	Retries  int
+	FailFast bool      /* skip whatever hasn't started once a job fails */
+	Out      io.Writer /* for progress, if anywhere */
+	JSON     bool
+
+	lock    sync.Mutex
+	results []JobResult
+	drawn   int
+	failed  bool
+}
+
+func NewPool(parallel int) *Pool {
+	if parallel <= 0 {
+		parallel = 1
+	}
+	return &Pool{
+		Parallel: parallel,
+		Out:      os.Stderr,
+		JSON:     !isTTY(os.Stderr),
+	}
+}
+
+func (p *Pool) Run(jobs []Job) []JobResult {
+	p.results = make([]JobResult, len(jobs))
+	for i, job := range jobs {
+		p.results[i] = JobResult{Name: job.Name, State: "pending"}
+	}
+	p.render(-1)
+
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < p.Parallel; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				if p.aborted() {
+					p.update(i, func(r *JobResult) {
+						r.State = "skipped"
+					})
+					continue
+				}
+				p.run(i, jobs[i])
+			}
+		}()
+	}
+	for i := range jobs {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+
+	return p.results
+}
+
+func (p *Pool) aborted() bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.FailFast && p.failed
+}
+
+func (p *Pool) run(i int, job Job) {
+	start := time.Now()
+	for attempt := 1; ; attempt++ {
+		p.update(i, func(r *JobResult) {
+			r.State = "running"
+			r.Attempts = attempt
+		})
+
+		err := job.Run()
+		if err == nil || attempt > p.Retries {
+			p.update(i, func(r *JobResult) {
+				r.Elapsed = time.Since(start)
+				r.err = err
+				if err != nil {
+					r.State = "failed"
+					r.Error = err.Error()
+					p.failed = true
+				} else {
+					r.State = "done"
+					r.Error = ""
+				}
+			})
+			return
+		}
+
+		p.update(i, func(r *JobResult) {
+			r.State = "retrying"
+			r.Error = err.Error()
+		})
+		time.Sleep(time.Duration(attempt) * time.Second)
+	}
+}
+
+func (p *Pool) update(i int, fn func(*JobResult)) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	fn(&p.results[i])
+	p.render(i)
+}
+
+var jobColors = map[string]string{
+	"pending":  "@K{%s}",
+	"running":  "@C{%s}",
+	"retrying": "@Y{%s}",
+	"done":     "@G{%s}",
+	"failed":   "@R{%s}",
+	"skipped":  "@K{%s}",
+}
+
+/* called with the lock held (or before any workers start) */
+func (p *Pool) render(changed int) {
+	if p.Out == nil {
+		return
+	}
+	if p.JSON {
+		if changed < 0 {
+			return
+		}
+		b, err := json.Marshal(p.results[changed])
+		if err == nil {
+			fmt.Fprintf(p.Out, "%s\n", string(b))
+		}
+		return
+	}
+
+	if p.drawn > 0 {
+		/* move back up over the previous table */
+		fmt.Fprintf(p.Out, "\033[%dA", p.drawn)
+	}
+
+	width := 0
+	for _, r := range p.results {
+		if len(r.Name) > width {
+			width = len(r.Name)
+		}
+	}
+	for _, r := range p.results {
+		state := ansi.Sprintf(jobColors[r.State], r.State)
+		line := fmt.Sprintf("  %-*s  %s", width, r.Name, state)
+		if r.Attempts > 1 {
+			line += fmt.Sprintf(" (attempt %d)", r.Attempts)
+		}
+		if r.Error != "" {
+			line += "  " + strings.SplitN(r.Error, "\n", 2)[0]
+		}
+		fmt.Fprintf(p.Out, "\033[2K%s\n", line)
+	}
+	p.drawn = len(p.results)
+}
+
+func Failures(results []JobResult) []error {
+	var errs []error
+	for _, r := range results {
+		if r.err != nil {
+			errs = append(errs, fmt.Errorf("%s: %s", r.Name, r.err))
+		}
+	}
+	return errs
+}
+
+// ExitStatus is the exit code for a bulk operation: the one that all
+// of the failures have in common, if they do.
+func ExitStatus(results []JobResult) int {
+	code := ExitOK
+	for _, r := range results {
+		if r.err == nil {
+			continue
+		}
+		switch c := exitCode(r.err); {
+		case code == ExitOK:
+			code = c
+		case code != c:
+			return ExitFailure
+		}
+	}
+	return code
+}
+
+func Summarize(w io.Writer, results []JobResult) {
+	ok, failed, skipped := 0, 0, 0
+	for _, r := range results {
+		if r.err != nil {
+			failed++
+		} else if r.State == "skipped" {
+			skipped++
+		} else {
+			ok++
+		}
+	}
+
+	if skipped > 0 {
+		ansi.Fprintf(w, "\n@G{%d} succeeded, @R{%d} failed, @Y{%d} skipped\n", ok, failed, skipped)
+	} else {
+		ansi.Fprintf(w, "\n@G{%d} succeeded, @R{%d} failed\n", ok, failed)
+	}
+	for _, err := range Failures(results) {
+		ansi.Fprintf(w, "  @R{!!!} %s\n", err)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+)
+
+type Endpoint struct {
+	Host string
+	Port int
+}
+
+func (e Endpoint) String() string {
+	return net.JoinHostPort(e.Host, strconv.Itoa(e.Port))
+}
+
+func findEndpoint(creds interface{}) (Endpoint, bool) {
+	m, ok := creds.(map[string]interface{})
+	if !ok {
+		return Endpoint{}, false
+	}
+
+	host := ""
+	for _, k := range []string{"host", "hostname", "address"} {
+		if s, ok := m[k].(string); ok && s != "" {
+			host = s
+			break
+		}
+	}
+	if host == "" {
+		if l, ok := m["hosts"].([]interface{}); ok && len(l) > 0 {
+			host, _ = l[0].(string)
+		}
+	}
+
+	port := 0
+	switch p := m["port"].(type) {
+	case int:
+		port = p
+	case int64:
+		port = int(p)
+	case float64:
+		port = int(p)
+	case string:
+		port, _ = strconv.Atoi(p)
+	}
+
+	if host != "" && port > 0 {
+		return Endpoint{Host: host, Port: port}, true
+	}
+
+	for _, v := range m {
+		if e, ok := findEndpoint(v); ok {
+			return e, true
+		}
+	}
+	return Endpoint{}, false
+}
+
+func probe(creds string, timeout time.Duration) (Endpoint, error) {
+	v, err := parseYAML(creds)
+	if err != nil {
+		return Endpoint{}, err
+	}
+
+	e, ok := findEndpoint(v)
+	if !ok {
+		return e, fmt.Errorf("unable to determine a host and port from the instance credentials")
+	}
+
+	conn, err := net.DialTimeout("tcp", e.String(), timeout)
+	if err != nil {
+		return e, err
+	}
+	conn.Close()
+	return e, nil
+}
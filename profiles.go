@@ -0,0 +1,168 @@
+package main
+
+import (
+	"os"
+	"sort"
+	"strings"
+
+	fmt "github.com/jhunt/boss/ansi"
+)
+
+// Profile is a named environment (i.e. prod, staging or lab), chosen
+// with -e, that bundles up where a Blacksmith is and how to talk to it,
+// along with how careful to be with it.  Profiles live in the config
+// file, under environments:.
+type Profile struct {
+	URL        string `json:"url"`
+	Username   string `json:"username,omitempty"`
+	Password   string `json:"password,omitempty"`
+	CACert     string `json:"ca_cert,omitempty"` /* PEM, or a path to one */
+	SkipVerify bool   `json:"skip_verify,omitempty"`
+	Role       string `json:"role,omitempty"`
+	Theme      string `json:"theme,omitempty"`
+	ASCII      bool   `json:"ascii,omitempty"`
+
+	/* protected environments make you type their name before
+	   running anything destructive */
+	Protected bool `json:"protected,omitempty"`
+}
+
+// destructiveCommands are those that a protected environment wants
+// confirmation for, since they can lose data or disrupt service.
+// raw is only one of them when it would change something; see
+// isDestructive.
+var destructiveCommands = map[string]bool{
+	"apply":        true,
+	"cancel":       true,
+	"delete":       true,
+	"deprovision":  true,
+	"errand":       true,
+	"migrate":      true,
+	"purge":        true,
+	"recreds":      true,
+	"redeploy":     true,
+	"restore":      true,
+	"rotate-creds": true,
+	"update":       true,
+	"upgrade":      true,
+	"upgrade-all":  true,
+}
+
+/* whether the command being run is one of those */
+var destructive bool
+
+// isDestructive is whether a command, given these arguments, is one
+// that a protected environment wants confirmation for.
+func isDestructive(command string, args []string) bool {
+	if command == "raw" {
+		return len(args) >= 2 && mutating(strings.ToUpper(args[0]), args[1])
+	}
+	return destructiveCommands[command]
+}
+
+func (cfg *Config) Profile(name string) (*Profile, error) {
+	if p, ok := cfg.Profiles[name]; ok {
+		return p, nil
+	}
+
+	names := make([]string, 0, len(cfg.Profiles))
+	for name := range cfg.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return nil, fmt.Errorf("no environment named `%s' in %s", name, bossFile(configFile)+didYouMean(suggest(name, names, false), singleQuote))
+}
+
+// ProfileFor finds the environment (if any) for a broker URL, so that
+// a protected environment is protected however it's reached.  If more
+// than one environment uses the URL, the protected ones come first.
+func (cfg *Config) ProfileFor(url string) (string, *Profile) {
+	names := make([]string, 0, len(cfg.Profiles))
+	for name, p := range cfg.Profiles {
+		if p.URL != "" && cfg.TargetURL(p.URL) == url {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return "", nil
+	}
+	sort.Slice(names, func(i, j int) bool {
+		a, b := cfg.Profiles[names[i]], cfg.Profiles[names[j]]
+		if a.Protected != b.Protected {
+			return a.Protected
+		}
+		return names[i] < names[j]
+	})
+	return names[0], cfg.Profiles[names[0]]
+}
+
+// applyProfile sets the environment's settings, which come before the
+// current target's.  Its URL and credentials go together, as a unit: an
+// environment's password is only ever sent to that environment's URL.
+func applyProfile(cfg *Config) error {
+	if opt.Environment == "" {
+		return nil
+	}
+	p, err := cfg.Profile(opt.Environment)
+	if err != nil {
+		return err
+	}
+
+	source := fmt.Sprintf("config (environment %s)", opt.Environment)
+	if p.URL == "" {
+		if p.Username != "" || p.Password != "" {
+			return fmt.Errorf("the %s environment has credentials, but no url to use them with", opt.Environment)
+		}
+	} else {
+		url := cfg.TargetURL(p.URL)
+		if opt.URL != "" && cfg.TargetURL(opt.URL) != url {
+			return fmt.Errorf("the %s environment is at %s, but %s asks for %s", opt.Environment, url, optionSources["url"], opt.URL)
+		}
+		setOption("url", url, source)
+
+		/* only a flag can override the environment's own credentials */
+		set := func(name string, v interface{}) {
+			if !strings.HasPrefix(optionSources[name], "flag") {
+				setOption(name, v, source)
+			}
+		}
+		if p.Username != "" {
+			set("username", p.Username)
+			set("password", p.Password)
+		}
+		if p.CACert != "" {
+			set("ca-cert", p.CACert)
+		}
+		if p.SkipVerify {
+			set("skip-ssl-validation", true)
+		}
+	}
+
+	fill := func(name string, v interface{}, set bool) {
+		if set && optionSources[name] == "" {
+			setOption(name, v, source)
+		}
+	}
+	fill("theme", p.Theme, p.Theme != "")
+	fill("ascii", true, p.ASCII)
+	return nil
+}
+
+// guardEnvironment makes the user type the name of a protected
+// environment before running a destructive command against it.
+func guardEnvironment(cfg *Config, command string, args []string) {
+	if !isDestructive(command, args) || opt.DryRun || opt.Help {
+		return
+	}
+	/* by URL, so that -U or `target --use` don't get around it */
+	name, p := cfg.ProfileFor(opt.URL)
+	if p == nil || !p.Protected {
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "@R{The} @Y{%s} @R{environment is protected, and} @C{%s} @R{can't be undone.}\n", name, command)
+	if !confirm(fmt.Sprintf("Type @Y{%s} to continue: ", name), name) {
+		fmt.Fprintf(os.Stderr, "@R{aborted.}\n")
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Progress hears about long-running operations each time they are
+// polled, and once more when they are over, so that it can tell the
+// user what's happening while they wait.
+type Progress interface {
+	Update(id, kind string, op Operation, elapsed time.Duration)
+	Done(id string, err error)
+}
+
+func (c *Client) progress(id, kind string, op Operation, elapsed time.Duration) {
+	if c.Progress != nil {
+		c.Progress.Update(id, kind, op, elapsed)
+	}
+}
+
+func (c *Client) progressDone(id string, err error) {
+	if c.Progress != nil {
+		c.Progress.Done(id, err)
+	}
+}
+
+var spinnerFrames = []string{"|", "/", "-", "\\"}
+
+type phase struct {
+	kind    string
+	stage   string
+	start   time.Time
+	updated time.Time /* when we last logged it, without a TTY */
+}
+
+// Spinner is a Progress that redraws a single status line on a
+// terminal, or failing that, logs a line whenever an operation moves
+// to a new stage (and every so often, if it doesn't).
+type Spinner struct {
+	Out   io.Writer
+	TTY   bool
+	Every time.Duration /* how often to log, without a TTY */
+
+	lock   sync.Mutex
+	phases map[string]*phase
+	frame  int
+	stop   chan struct{}
+}
+
+func NewSpinner(out *os.File) *Spinner {
+	return &Spinner{
+		Out:    out,
+		TTY:    isTTY(out),
+		Every:  30 * time.Second,
+		phases: make(map[string]*phase),
+	}
+}
+
+/* what the broker says it's doing, i.e. "deploying (task 42)" */
+func stageOf(op Operation) string {
+	if op.Description != "" {
+		return op.Description
+	}
+	if op.State != "" {
+		return op.State
+	}
+	return "waiting"
+}
+
+func (s *Spinner) Update(id, kind string, op Operation, elapsed time.Duration) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	now := time.Now()
+	p, ok := s.phases[id]
+	if !ok {
+		p = &phase{kind: kind, start: now.Add(-elapsed)}
+		s.phases[id] = p
+	}
+	stage := stageOf(op)
+	changed := stage != p.stage
+	p.stage = stage
+
+	if s.TTY {
+		if s.stop == nil {
+			s.stop = make(chan struct{})
+			go s.spin(s.stop)
+		}
+		return
+	}
+	if changed || now.Sub(p.updated) >= s.Every {
+		p.updated = now
+		fmt.Fprintf(s.Out, "[%s] %s %s: %s\n", elapsed.Round(time.Second), p.kind, id, stage)
+	}
+}
+
+func (s *Spinner) Done(id string, err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	p, ok := s.phases[id]
+	if !ok {
+		return
+	}
+	delete(s.phases, id)
+	if !s.TTY {
+		return
+	}
+
+	s.clear()
+	if len(s.phases) == 0 && s.stop != nil {
+		close(s.stop)
+		s.stop = nil
+	}
+	outcome := "done"
+	switch {
+	case errors.Is(err, ErrTimeout):
+		outcome = "still waiting"
+	case err != nil:
+		outcome = "failed"
+	}
+	fmt.Fprintf(s.Out, "%s %s: %s after %s\n", p.kind, id, outcome, time.Since(p.start).Round(time.Second))
+}
+
+func (s *Spinner) spin(stop chan struct{}) {
+	t := time.NewTicker(100 * time.Millisecond)
+	defer t.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-t.C:
+			s.lock.Lock()
+			s.draw()
+			s.lock.Unlock()
+		}
+	}
+}
+
+func (s *Spinner) clear() {
+	fmt.Fprintf(s.Out, "\r\033[K")
+}
+
+/* draw is called with the lock held */
+func (s *Spinner) draw() {
+	if len(s.phases) == 0 {
+		return
+	}
+	s.frame = (s.frame + 1) % len(spinnerFrames)
+
+	ids := make([]string, 0, len(s.phases))
+	for id := range s.phases {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	start := s.phases[ids[0]].start
+	for _, id := range ids {
+		if s.phases[id].start.Before(start) {
+			start = s.phases[id].start
+		}
+	}
+
+	line := fmt.Sprintf("%d operations in progress (%s)", len(ids), strings.Join(ids, ", "))
+	if len(ids) == 1 {
+		p := s.phases[ids[0]]
+		line = fmt.Sprintf("%s %s: %s", p.kind, ids[0], p.stage)
+	}
+
+	s.clear()
+	fmt.Fprintf(s.Out, "%s %s  [%s]", spinnerFrames[s.frame], line, time.Since(start).Round(time.Second))
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"strconv"
+)
+
+// metaInt reads the first of the given plan metadata keys that holds
+// a whole number (or a string of one), returning 0 if none do.
+func (p Plan) metaInt(keys ...string) int {
+	for _, k := range keys {
+		switch v := p.Metadata[k].(type) {
+		case float64:
+			return int(v)
+		case int64:
+			return int(v)
+		case int:
+			return v
+		case string:
+			if n, err := strconv.Atoi(v); err == nil {
+				return n
+			}
+		}
+	}
+	return 0
+}
+
+// Limit returns the most instances the broker will deploy of this plan,
+// as advertised in the plan metadata, or 0 if the plan is unlimited.
+func (p Plan) Limit() int {
+	return p.metaInt("limit", "quota", "max_instances")
+}
+
+type Quota struct {
+	Service *Service
+	Plan    *Plan
+	Used    int
+	Limit   int
+}
+
+// Remaining returns how many more instances can be deployed,
+// or -1 if the plan is unlimited.
+func (q Quota) Remaining() int {
+	if q.Limit <= 0 {
+		return -1
+	}
+	if q.Used >= q.Limit {
+		return 0
+	}
+	return q.Limit - q.Used
+}
+
+func (q Quota) Exhausted() bool {
+	return q.Remaining() == 0
+}
+
+// Quotas counts the deployed instances of every plan in the catalog,
+// alongside that plan's limit.
+func (c *Client) Quotas() ([]Quota, error) {
+	cat, err := c.Catalog()
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := c.status()
+	if err != nil {
+		return nil, err
+	}
+
+	used := make(map[string]int)
+	for _, inst := range out.Instances {
+		used[inst.ServiceID+"/"+inst.PlanID]++
+	}
+
+	quotas := make([]Quota, 0)
+	for i := range cat.Services {
+		s := &cat.Services[i]
+		for j := range s.Plans {
+			p := &s.Plans[j]
+			quotas = append(quotas, Quota{
+				Service: s,
+				Plan:    p,
+				Used:    used[s.ID+"/"+p.ID],
+				Limit:   p.Limit(),
+			})
+		}
+	}
+	return quotas, nil
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"regexp"
+)
+
+const redacted = "[REDACTED]"
+
+var (
+	secretWords = `[\w.-]*(?:pass(?:word|wd)?|secret|token|private[_-]?key|api[_-]?key|credential|cert(?:ificate)?)[\w.-]*`
+
+	redactHeader = regexp.MustCompile(`(?mi)^((?:Proxy-)?Authorization|Cookie|Set-Cookie):[^\r\n]*`)
+	redactJSON   = regexp.MustCompile(`(?i)("` + secretWords + `"\s*:\s*)"(?:[^"\\]|\\.)*"`)
+	redactYAML   = regexp.MustCompile(`(?mi)^(\s*(?:-\s+)?` + secretWords + `\s*:)[ \t]+[^\s|>].*$`)
+	redactURI    = regexp.MustCompile(`(\b[a-z][a-z0-9+.-]*://[^:/@\s]+:)[^@\s]+@`)
+	redactPEM    = regexp.MustCompile(`(-----BEGIN [A-Z ]*PRIVATE KEY-----)[\s\S]*?(-----END [A-Z ]*PRIVATE KEY-----)`)
+)
+
+func redact(b []byte) []byte {
+	b = redactHeader.ReplaceAll(b, []byte("$1: "+redacted))
+	b = redactJSON.ReplaceAll(b, []byte(`$1"`+redacted+`"`))
+	b = redactYAML.ReplaceAll(b, []byte("$1 "+redacted))
+	b = redactURI.ReplaceAll(b, []byte("${1}"+redacted+"@"))
+	b = redactPEM.ReplaceAll(b, []byte("$1 "+redacted+" $2"))
+	return b
+}
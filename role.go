@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+var readOnlyCommands = []string{
+	"alias", "binding", "capacity", "catalog", "config", "creds", "events",
+	"export", "history", "info", "instance", "last-operation", "list", "log",
+	"manifest", "metrics", "nodes", "open", "params", "ping", "plan", "quotas",
+	"role", "schema-dump", "target", "task", "test", "vms", "wait",
+}
+
+var DefaultRoles = map[string][]string{
+	"viewer": readOnlyCommands,
+	"operator": append([]string{
+		"backup", "cancel", "clone", "create", "errand", "import", "migrate",
+		"provision", "recreds", "redeploy", "rotate-creds", "ssh", "update",
+		"upgrade", "upgrade-all",
+	}, readOnlyCommands...),
+	"admin": {"*"},
+}
+
+func (cfg *Config) roles() map[string][]string {
+	roles := make(map[string][]string)
+	for name, commands := range DefaultRoles {
+		roles[name] = commands
+	}
+	for name, commands := range cfg.Roles {
+		roles[name] = commands
+	}
+	return roles
+}
+
+func (cfg *Config) RoleNames() []string {
+	names := make([]string, 0)
+	for name := range cfg.roles() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (cfg *Config) HasRole(role string) bool {
+	_, ok := cfg.roles()[role]
+	return ok
+}
+
+// Permits reports whether the given role is allowed to run a command.
+// An empty role (no role selected for the target) permits everything.
+func (cfg *Config) Permits(role, command string) (bool, error) {
+	if role == "" || command == "role" {
+		return true, nil
+	}
+
+	commands, ok := cfg.roles()[role]
+	if !ok {
+		return false, fmt.Errorf("unknown role '%s'", role)
+	}
+	for _, c := range commands {
+		if c == "*" || c == command {
+			return true, nil
+		}
+	}
+	return false, nil
+}
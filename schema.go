@@ -0,0 +1,415 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+type InputParameters struct {
+	Parameters map[string]interface{} `json:"parameters,omitempty"`
+}
+
+type Schemas struct {
+	ServiceInstance struct {
+		Create InputParameters `json:"create"`
+		Update InputParameters `json:"update"`
+	} `json:"service_instance"`
+	ServiceBinding struct {
+		Create InputParameters `json:"create"`
+	} `json:"service_binding"`
+}
+
+// CreateSchema returns the JSON schema a plan declares for
+// provisioning parameters, or nil if it doesn't declare one.
+func (p Plan) CreateSchema() map[string]interface{} {
+	if p.Schemas == nil {
+		return nil
+	}
+	return p.Schemas.ServiceInstance.Create.Parameters
+}
+
+func (p Plan) UpdateSchema() map[string]interface{} {
+	if p.Schemas == nil {
+		return nil
+	}
+	return p.Schemas.ServiceInstance.Update.Parameters
+}
+
+type SchemaField struct {
+	Name        string
+	Type        string
+	Required    bool
+	Description string
+	Default     interface{}
+	Enum        []interface{}
+}
+
+// SchemaFields summarizes the top-level properties of a JSON schema,
+// sorted by name.
+func SchemaFields(schema map[string]interface{}) []SchemaField {
+	props, _ := schema["properties"].(map[string]interface{})
+	required := make(map[string]bool)
+	if l, ok := schema["required"].([]interface{}); ok {
+		for _, r := range l {
+			if s, ok := r.(string); ok {
+				required[s] = true
+			}
+		}
+	}
+
+	fields := make([]SchemaField, 0, len(props))
+	for name, v := range props {
+		prop, _ := v.(map[string]interface{})
+		f := SchemaField{Name: name, Required: required[name], Default: prop["default"]}
+		f.Type, _ = prop["type"].(string)
+		f.Description, _ = prop["description"].(string)
+		f.Enum, _ = prop["enum"].([]interface{})
+		fields = append(fields, f)
+	}
+	sort.Slice(fields, func(i, j int) bool {
+		return fields[i].Name < fields[j].Name
+	})
+	return fields
+}
+
+// ParamDefaults are the defaults a JSON schema gives its properties,
+// nested ones included, keyed by their dotted path (i.e. tls.enabled).
+func ParamDefaults(schema map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{})
+	paramDefaults("", schema, out)
+	return out
+}
+
+func paramDefaults(prefix string, schema map[string]interface{}, out map[string]interface{}) {
+	props, _ := schema["properties"].(map[string]interface{})
+	for name, v := range props {
+		prop, _ := v.(map[string]interface{})
+		if d, ok := prop["default"]; ok {
+			out[prefix+name] = d
+		}
+		paramDefaults(prefix+name+".", prop, out)
+	}
+}
+
+// FlattenParams keys every (non-map) value in params by its dotted path.
+func FlattenParams(params map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{})
+	flattenParams("", params, out)
+	return out
+}
+
+func flattenParams(prefix string, params map[string]interface{}, out map[string]interface{}) {
+	for k, v := range params {
+		if m, ok := v.(map[string]interface{}); ok && len(m) > 0 {
+			flattenParams(prefix+k+".", m, out)
+			continue
+		}
+		out[prefix+k] = v
+	}
+}
+
+// ParamDiff is how one parameter of an instance compares to the
+// default its plan's schema gives it.
+type ParamDiff struct {
+	Name    string      `json:"name"`
+	Default interface{} `json:"default,omitempty"`
+	Value   interface{} `json:"value,omitempty"`
+	Status  string      `json:"status"` /* default, override, unset or custom */
+}
+
+// DiffParams compares stored parameters to the schema's defaults:
+// a parameter is "default" if set to its default, an "override" if set
+// to something else, "unset" if only the default applies, and "custom"
+// if the schema has no default for it at all.
+func DiffParams(schema, params map[string]interface{}) []ParamDiff {
+	defaults := ParamDefaults(schema)
+	values := FlattenParams(params)
+
+	l := make([]ParamDiff, 0, len(values)+len(defaults))
+	for name, v := range values {
+		d, ok := defaults[name]
+		p := ParamDiff{Name: name, Default: d, Value: v, Status: "custom"}
+		if ok {
+			p.Status = "override"
+			if sameParam(d, v) {
+				p.Status = "default"
+			}
+		}
+		l = append(l, p)
+	}
+	for name, d := range defaults {
+		if _, ok := values[name]; !ok {
+			l = append(l, ParamDiff{Name: name, Default: d, Status: "unset"})
+		}
+	}
+	sort.Slice(l, func(i, j int) bool {
+		return l[i].Name < l[j].Name
+	})
+	return l
+}
+
+/* compare as JSON, so that 5 and 5.0 (and so on) are the same */
+func sameParam(a, b interface{}) bool {
+	x, err1 := json.Marshal(a)
+	y, err2 := json.Marshal(b)
+	return err1 == nil && err2 == nil && string(x) == string(y)
+}
+
+type ParamError struct {
+	Field   string
+	Problem string
+}
+
+func (e ParamError) Error() string {
+	if e.Field == "" {
+		return e.Problem
+	}
+	return fmt.Sprintf("%s: %s", e.Field, e.Problem)
+}
+
+// ValidateParams checks parameters against (the commonly-used parts
+// of) a JSON schema, and returns everything that is wrong with them.
+func ValidateParams(schema map[string]interface{}, params map[string]interface{}) []ParamError {
+	errs := make([]ParamError, 0)
+	if schema == nil {
+		return errs
+	}
+
+	var v interface{} = map[string]interface{}{}
+	if params != nil {
+		v = params
+	}
+	validate("", schema, v, &errs)
+	return errs
+}
+
+func validate(path string, schema map[string]interface{}, v interface{}, errs *[]ParamError) {
+	fail := func(msg string, args ...interface{}) {
+		*errs = append(*errs, ParamError{Field: path, Problem: fmt.Sprintf(msg, args...)})
+	}
+
+	if t, ok := schema["type"].(string); ok && !isType(t, v) {
+		fail("expected %s, got %s", t, typeOf(v))
+		return
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, e := range enum {
+			if fmt.Sprintf("%v", e) == fmt.Sprintf("%v", v) {
+				found = true
+			}
+		}
+		if !found {
+			fail("must be one of %v", enum)
+		}
+	}
+
+	switch v := v.(type) {
+	case string:
+		if n, ok := number(schema["minLength"]); ok && float64(len(v)) < n {
+			fail("must be at least %v characters long", n)
+		}
+		if n, ok := number(schema["maxLength"]); ok && float64(len(v)) > n {
+			fail("must be at most %v characters long", n)
+		}
+		if p, ok := schema["pattern"].(string); ok {
+			if re, err := regexp.Compile(p); err == nil && !re.MatchString(v) {
+				fail("must match /%s/", p)
+			}
+		}
+
+	case map[string]interface{}:
+		props, _ := schema["properties"].(map[string]interface{})
+		if l, ok := schema["required"].([]interface{}); ok {
+			for _, r := range l {
+				if name, ok := r.(string); ok {
+					if _, present := v[name]; !present {
+						*errs = append(*errs, ParamError{Field: join(path, name), Problem: "is required"})
+					}
+				}
+			}
+		}
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if sub, ok := props[k].(map[string]interface{}); ok {
+				validate(join(path, k), sub, v[k], errs)
+			} else if extra, ok := schema["additionalProperties"].(bool); ok && !extra {
+				*errs = append(*errs, ParamError{Field: join(path, k), Problem: "is not a recognized parameter"})
+			}
+		}
+
+	case []interface{}:
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range v {
+				validate(fmt.Sprintf("%s[%d]", path, i), items, item, errs)
+			}
+		}
+
+	default:
+		if n, ok := number(v); ok {
+			if min, ok := number(schema["minimum"]); ok && n < min {
+				fail("must be at least %v", min)
+			}
+			if max, ok := number(schema["maximum"]); ok && n > max {
+				fail("must be at most %v", max)
+			}
+		}
+	}
+}
+
+func join(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func number(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int64:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func typeOf(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	}
+	if n, ok := number(v); ok {
+		if n == float64(int64(n)) {
+			return "integer"
+		}
+		return "number"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+func isType(want string, v interface{}) bool {
+	got := typeOf(v)
+	return got == want || want == "number" && got == "integer"
+}
+
+// ReadParams parses parameters given on the command line, either
+// inline or from a file (as @file), in JSON or YAML.
+func ReadParams(s string) (map[string]interface{}, error) {
+	if strings.HasPrefix(s, "@") {
+		b, err := ioutil.ReadFile(s[1:])
+		if err != nil {
+			return nil, err
+		}
+		s = string(b)
+	}
+
+	var out map[string]interface{}
+	if err := json.Unmarshal([]byte(s), &out); err == nil {
+		return out, nil
+	}
+
+	v, err := parseYAML(s)
+	if err != nil {
+		return nil, fmt.Errorf("parameters are neither valid JSON nor YAML: %s", err)
+	}
+	out, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("parameters must be a map of names to values")
+	}
+	return out, nil
+}
+
+/* the type (if any) that a JSON schema gives a dotted parameter name */
+func schemaType(schema map[string]interface{}, keys []string) string {
+	for _, k := range keys {
+		props, _ := schema["properties"].(map[string]interface{})
+		schema, _ = props[k].(map[string]interface{})
+	}
+	t, _ := schema["type"].(string)
+	return t
+}
+
+// MergeParams merges over into (a copy of) base: maps are merged key
+// by key, nulls remove keys, and anything else replaces what was there.
+func MergeParams(base, over map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(base))
+	for k, v := range base {
+		out[k] = v
+	}
+	for k, v := range over {
+		if v == nil {
+			delete(out, k)
+			continue
+		}
+		a, aok := out[k].(map[string]interface{})
+		b, bok := v.(map[string]interface{})
+		if aok && bok {
+			out[k] = MergeParams(a, b)
+		} else {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+// SetParam applies a --set key=value to params.  Dotted keys reach
+// into nested maps, and null removes the key altogether.  Values are
+// strings (so that 1.10 stays 1.10), unless the plan's schema says the
+// parameter is a number, a boolean, or something else.
+func SetParam(params, schema map[string]interface{}, kv string) error {
+	l := strings.SplitN(kv, "=", 2)
+	if len(l) != 2 || l[0] == "" {
+		return fmt.Errorf("invalid --set '%s' (expected key=value)", kv)
+	}
+
+	keys := strings.Split(l[0], ".")
+	var v interface{} = l[1]
+	if t := schemaType(schema, keys); l[1] == "null" {
+		v = nil
+	} else if t != "" && t != "string" {
+		parsed, err := parseYAML(l[1])
+		if err != nil || !isType(t, parsed) {
+			return fmt.Errorf("invalid --set '%s': %s should be a %s", kv, l[0], t)
+		}
+		v = parsed
+	}
+
+	m := params
+	for _, k := range keys[:len(keys)-1] {
+		/* copy on the way down, so as not to touch maps shared with
+		   whatever params was merged from */
+		next, _ := m[k].(map[string]interface{})
+		next = MergeParams(next, nil)
+		m[k] = next
+		m = next
+	}
+	if v == nil {
+		delete(m, keys[len(keys)-1])
+	} else {
+		m[keys[len(keys)-1]] = v
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSetParam(t *testing.T) {
+	schema := map[string]interface{}{
+		"properties": map[string]interface{}{
+			"version":         map[string]interface{}{"type": "string"},
+			"max_connections": map[string]interface{}{"type": "integer"},
+			"ratio":           map[string]interface{}{"type": "number"},
+			"tls": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"enabled": map[string]interface{}{"type": "boolean"},
+				},
+			},
+			"hosts": map[string]interface{}{"type": "array"},
+		},
+	}
+
+	tests := []struct {
+		kv   string
+		key  string
+		want interface{}
+	}{
+		{"version=1.10", "version", "1.10"},
+		{"max_connections=500", "max_connections", 500},
+		{"ratio=0.5", "ratio", 0.5},
+		{"tls.enabled=true", "tls", map[string]interface{}{"enabled": true}},
+		{"hosts=[a, b]", "hosts", []interface{}{"a", "b"}},
+		{"unknown=1.10", "unknown", "1.10"},
+		{"unknown=yes", "unknown", "yes"},
+		{"unknown=", "unknown", ""},
+	}
+	for _, test := range tests {
+		params := map[string]interface{}{}
+		if err := SetParam(params, schema, test.kv); err != nil {
+			t.Errorf("%s: unexpected error: %s", test.kv, err)
+			continue
+		}
+		if got := params[test.key]; !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %#v, want %#v", test.kv, got, test.want)
+		}
+	}
+
+	params := map[string]interface{}{"version": "1.0"}
+	if err := SetParam(params, schema, "version=null"); err != nil || len(params) != 0 {
+		t.Errorf("version=null: got %#v, %v; want it removed", params, err)
+	}
+
+	for _, kv := range []string{"max_connections=lots", "tls.enabled=maybe", "ratio=", "=1", "novalue"} {
+		if err := SetParam(map[string]interface{}{}, schema, kv); err == nil {
+			t.Errorf("%s: expected an error", kv)
+		}
+	}
+}
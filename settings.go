@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/jhunt/go-cli"
+)
+
+// Global options are layered: command-line flags win over environment
+// variables, which win over the config file.  From the config file come
+// the -e environment, the current target (and the credentials saved with
+// it), and then any defaults, keyed by long option name, i.e.
+//
+//	target: prod
+//	defaults:
+//	  json: true
+//	  name-prefix: team-dev
+//
+// optionSources remembers where each option that has a value got it.
+var optionSources = make(map[string]string)
+
+type globalOption struct {
+	name  string /* long flag, minus the -- */
+	env   string
+	value reflect.Value
+}
+
+func globalOptions() []globalOption {
+	return optionsOf(&opt)
+}
+
+func optionsOf(opts interface{}) []globalOption {
+	v := reflect.ValueOf(opts).Elem()
+	l := make([]globalOption, 0)
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Type().Field(i)
+		if f.Type.Kind() == reflect.Struct {
+			continue /* a command */
+		}
+		tag := f.Tag.Get("cli")
+		for _, flag := range strings.Split(tag, ",") {
+			flag = strings.TrimSpace(flag)
+			if strings.HasPrefix(flag, "--no-") && strings.Contains(tag, "--"+flag[5:]+",") {
+				continue /* the negation of a --flag we already have */
+			}
+			if strings.HasPrefix(flag, "--") {
+				l = append(l, globalOption{name: flag[2:], env: f.Tag.Get("env"), value: v.Field(i)})
+			}
+		}
+	}
+	return l
+}
+
+// noteEnvSources credits every option whose environment variable is
+// set to the environment, as go-envirotron only uses those that are.
+func noteEnvSources() {
+	for _, o := range globalOptions() {
+		if o.env != "" && os.Getenv(o.env) != "" {
+			optionSources[o.name] = "env ($" + o.env + ")"
+		}
+	}
+}
+
+// noteFlagSources credits every option given in args to the command
+// line, even if it was given the value it already had (i.e. --parallel
+// 0, or --no-json), so that the config file doesn't override it.  The
+// arguments are parsed twice, into copies of the options set to two
+// different sentinels; the options that come out the same were given.
+func noteFlagSources(args []string) {
+	a, b := opt, opt
+	for i, o := range optionsOf(&a) {
+		other := optionsOf(&b)[i].value
+		switch o.value.Kind() {
+		case reflect.String:
+			o.value.SetString("\x00a")
+			other.SetString("\x00b")
+		case reflect.Bool:
+			o.value.SetBool(false)
+			other.SetBool(true)
+		case reflect.Int:
+			o.value.SetInt(-1)
+			other.SetInt(-2)
+		}
+	}
+	if _, _, err := cli.ParseArgs(&a, args); err != nil {
+		return /* the real parse will say why */
+	}
+	cli.ParseArgs(&b, args)
+
+	other := optionsOf(&b)
+	for i, o := range optionsOf(&a) {
+		if o.value.Interface() == other[i].value.Interface() {
+			optionSources[o.name] = "flag (--" + o.name + ")"
+		}
+	}
+}
+
+func setOption(name string, v interface{}, source string) error {
+	for _, o := range globalOptions() {
+		if o.name != name {
+			continue
+		}
+		switch o.value.Kind() {
+		case reflect.String:
+			o.value.SetString(asString(v))
+		case reflect.Bool:
+			o.value.SetBool(asString(v) == "true" || asString(v) == "yes")
+		case reflect.Int:
+			o.value.SetInt(int64(asInt(v)))
+		default:
+			return fmt.Errorf("option --%s cannot be set from the config file", name)
+		}
+		optionSources[name] = source
+		return nil
+	}
+	return fmt.Errorf("unrecognized option `%s' in config file defaults", name)
+}
+
+// TargetURL finds a target by name, or failing that, takes name to be
+// the target URL itself.
+func (cfg *Config) TargetURL(name string) string {
+	for _, url := range cfg.URLs() {
+		if cfg.Targets[url].Name == name {
+			return url
+		}
+	}
+	return name
+}
+
+// applyConfig fills in whatever options weren't given as flags or in
+// the environment, from the config file: the -e environment, if any,
+// comes first.
+func applyConfig(cfg *Config) error {
+	if err := applyProfile(cfg); err != nil {
+		return err
+	}
+	if opt.URL == "" && cfg.Current != "" {
+		if err := setOption("url", cfg.TargetURL(cfg.Current), "config (target)"); err != nil {
+			return err
+		}
+	} else if opt.URL != "" {
+		/* -U can name a target, too */
+		opt.URL = cfg.TargetURL(opt.URL)
+	}
+
+	if t, ok := cfg.Targets[opt.URL]; ok {
+		source := fmt.Sprintf("config (target %s)", cfg.Label(opt.URL))
+		if opt.Username == "" && t.Username != "" {
+			setOption("username", t.Username, source)
+			if opt.Password == "" {
+				setOption("password", t.Password, source)
+			}
+		}
+		if !opt.SkipSSLValidation && t.SkipVerify {
+			setOption("skip-ssl-validation", true, source)
+		}
+	}
+
+	names := make([]string, 0, len(cfg.Defaults))
+	for name := range cfg.Defaults {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if optionSources[name] != "" {
+			continue
+		}
+		if err := setOption(name, cfg.Defaults[name], "config (defaults)"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type Setting struct {
+	Name   string      `json:"name"`
+	Value  interface{} `json:"value"`
+	Source string      `json:"source"`
+}
+
+// Settings lists every global option, its effective value, and where
+// that value came from, for boss config.
+func Settings() []Setting {
+	l := make([]Setting, 0)
+	for _, o := range globalOptions() {
+		if o.name == "help" || o.name == "version" {
+			continue
+		}
+		s := Setting{Name: o.name, Value: o.value.Interface(), Source: optionSources[o.name]}
+		if s.Source == "" {
+			s.Source = "default"
+		}
+		l = append(l, s)
+	}
+	return l
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// SSHTarget is what the BOSH CLI needs to reach the VMs
+// of the deployment behind a service instance.
+type SSHTarget struct {
+	Deployment   string `json:"deployment"`
+	Director     string `json:"director"`
+	CACert       string `json:"ca_cert,omitempty"`
+	Client       string `json:"client,omitempty"`
+	ClientSecret string `json:"client_secret,omitempty"`
+}
+
+// SSHTarget asks Blacksmith how to reach an instance's VMs.  Brokers
+// that can't say get the director address from /b/info, and the
+// deployment name Blacksmith gives every instance; the BOSH CLI will
+// have to already be logged in.
+func (c *Client) SSHTarget(id string) (SSHTarget, error) {
+	var out SSHTarget
+	_, err := c.request("GET", fmt.Sprintf("/b/%s/ssh.json", id), nil, &out)
+	var e APIError
+	if err == nil && out.Deployment != "" {
+		return out, nil
+	}
+	if err != nil && !(errors.Is(err, ErrNotFound) || errors.As(err, &e) && (e.StatusCode == 405 || e.StatusCode == 501)) {
+		return out, err
+	}
+
+	c.Logger.Debugf("ssh details not available from broker; deriving them", "instance", id, "error", err)
+	ref, err := c.instanceRef(id)
+	if err != nil {
+		return out, err
+	}
+	info, err := c.Info()
+	if err != nil {
+		return out, err
+	}
+
+	/* blacksmith names deployments PLAN-ID-INSTANCE-ID */
+	return SSHTarget{
+		Deployment: ref.PlanID + "-" + id,
+		Director:   info.BOSH.Address,
+	}, nil
+}
+
+// Env returns the BOSH_* environment variables for the BOSH CLI.
+func (t SSHTarget) Env() []string {
+	env := []string{"BOSH_DEPLOYMENT=" + t.Deployment}
+	if t.Director != "" {
+		env = append(env, "BOSH_ENVIRONMENT="+t.Director)
+	}
+	if t.CACert != "" {
+		env = append(env, "BOSH_CA_CERT="+t.CACert)
+	}
+	if t.Client != "" {
+		env = append(env, "BOSH_CLIENT="+t.Client)
+	}
+	if t.ClientSecret != "" {
+		env = append(env, "BOSH_CLIENT_SECRET="+t.ClientSecret)
+	}
+	return env
+}
+
+// Args returns the BOSH CLI arguments for ssh'ing into a node
+// (i.e. redis/0), or whichever one BOSH picks if node is empty.
+func (t SSHTarget) Args(node string) []string {
+	args := []string{"-d", t.Deployment, "ssh"}
+	if node != "" {
+		args = append(args, node)
+	}
+	return args
+}
+
+// Script renders the target as shell commands to run by hand.
+func (t SSHTarget) Script(node string) string {
+	var b strings.Builder
+	for _, kv := range t.Env() {
+		l := strings.SplitN(kv, "=", 2)
+		fmt.Fprintf(&b, "export %s=%s\n", l[0], shellQuote(l[1]))
+	}
+	fmt.Fprintf(&b, "bosh %s\n", strings.Join(t.Args(node), " "))
+	return b.String()
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
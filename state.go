@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+/* boss keeps a little bit of local state (catalog pins, aliases,
+   history, ...) under ~/.boss, or wherever $BOSS_HOME points. */
+
+func bossDir() string {
+	if dir := os.Getenv("BOSS_HOME"); dir != "" {
+		return dir
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ".boss"
+	}
+	return filepath.Join(home, ".boss")
+}
+
+func bossFile(name string) string {
+	return filepath.Join(bossDir(), name)
+}
+
+func readState(name string, out interface{}) error {
+	b, err := ioutil.ReadFile(bossFile(name))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, out)
+}
+
+func writeState(name string, in interface{}) error {
+	if err := os.MkdirAll(bossDir(), 0700); err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(in, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := bossFile(name + ".tmp")
+	if err := ioutil.WriteFile(tmp, append(b, '\n'), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, bossFile(name))
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"time"
+)
+
+// idleReader closes the underlying body if no data arrives
+// for too long, so that a hung stream doesn't hang boss.
+type idleReader struct {
+	body    io.ReadCloser
+	timeout time.Duration
+	timer   *time.Timer
+
+	lock    sync.Mutex
+	expired bool
+}
+
+func newIdleReader(body io.ReadCloser, timeout time.Duration) *idleReader {
+	r := &idleReader{body: body, timeout: timeout}
+	r.timer = time.AfterFunc(timeout, func() {
+		r.lock.Lock()
+		r.expired = true
+		r.lock.Unlock()
+		body.Close()
+	})
+	return r
+}
+
+func (r *idleReader) Read(b []byte) (int, error) {
+	n, err := r.body.Read(b)
+	if n > 0 {
+		r.timer.Reset(r.timeout)
+	}
+	if err != nil {
+		r.lock.Lock()
+		expired := r.expired
+		r.lock.Unlock()
+		if expired {
+			return n, fmt.Errorf("no data received from the broker in %s", r.timeout)
+		}
+	}
+	return n, err
+}
+
+func (r *idleReader) Close() error {
+	r.timer.Stop()
+	return r.body.Close()
+}
+
+func (c *Client) idleTimeout() time.Duration {
+	if c.IdleTimeout > 0 {
+		return c.IdleTimeout
+	}
+	return 60 * time.Second
+}
+
+func (c *Client) streamText(path string, args ...interface{}) (string, error) {
+	res, err := c.do("GET", fmt.Sprintf(path, args...), nil)
+	if err != nil {
+		return "", err
+	}
+
+	body := newIdleReader(res.Body, c.idleTimeout())
+	defer body.Close()
+
+	b, err := ioutil.ReadAll(body)
+	if err != nil {
+		return "", err
+	}
+	if res.StatusCode != 200 {
+		return "", apiError(res, b)
+	}
+	return string(b), nil
+}
+
+// StreamTask writes the BOSH task log for an instance to out.  If
+// follow is set, it keeps writing new output as the task progresses,
+// riding out transient errors along the way.
+func (c *Client) StreamTask(id string, follow bool, out io.Writer) error {
+	return c.follow(out, follow, func() (string, error) {
+		return c.streamText("/b/%s/task.log", id)
+	})
+}
+
+// StreamLog writes the broker log to out.  If follow is set, it keeps
+// polling for new lines.  Blacksmith only keeps the tail end of its
+// log, so new output is found by looking for the last line we saw,
+// rather than by offset.
+func (c *Client) StreamLog(follow bool, out io.Writer) error {
+	prev, failed := "", 0
+	for {
+		s, err := c.Log()
+		if err != nil {
+			if !follow || !c.retryFollow(err, &failed) {
+				return err
+			}
+			continue
+		}
+		failed = 0
+		io.WriteString(out, logDelta(prev, s))
+		prev = s
+
+		if !follow {
+			return nil
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+func logDelta(prev, now string) string {
+	if strings.HasPrefix(now, prev) {
+		return now[len(prev):]
+	}
+
+	last := prev[strings.LastIndex(strings.TrimRight(prev, "\n"), "\n")+1:]
+	if i := strings.LastIndex(now, last); last != "" && i >= 0 {
+		return now[i+len(last):]
+	}
+	/* everything we saw has scrolled away */
+	return now
+}
+
+func (c *Client) follow(out io.Writer, follow bool, fetch func() (string, error)) error {
+	if !follow {
+		s, err := fetch()
+		if err == nil {
+			io.WriteString(out, s)
+		}
+		return err
+	}
+	return c.followUntil(out, fetch, func() (bool, error) {
+		return false, nil
+	})
+}
+
+/* how many times in a row following output can fail before we give up */
+const followRetries = 5
+
+// retryFollow decides whether following output should carry on after
+// err, waiting a bit first if so.  Errors from the broker that aren't
+// going to go away (i.e. a 404) stop it straight away; anything else
+// (a 502, a dropped connection) gets a few more tries.
+func (c *Client) retryFollow(err error, failed *int) bool {
+	var api APIError
+	if errors.As(err, &api) && !api.Retryable() {
+		return false
+	}
+	if *failed++; *failed > followRetries {
+		return false
+	}
+	c.Logger.Warnf("unable to fetch more output; retrying", "error", err, "attempt", *failed, "retries", followRetries)
+	time.Sleep(time.Second)
+	return true
+}
+
+// followUntil keeps writing new output until finished says there will
+// be no more.  That is checked before each fetch, so the last of the
+// output is never missed.
+func (c *Client) followUntil(out io.Writer, fetch func() (string, error), finished func() (bool, error)) error {
+	seen, failed := 0, 0
+	for {
+		done, err := finished()
+		var s string
+		if err == nil {
+			s, err = fetch()
+		}
+		if err != nil {
+			if !c.retryFollow(err, &failed) {
+				return err
+			}
+			continue
+		}
+		failed = 0
+
+		if len(s) < seen {
+			/* log was truncated or rotated; start over */
+			seen = 0
+		}
+		if len(s) > seen {
+			io.WriteString(out, s[seen:])
+			seen = len(s)
+		}
+
+		if done {
+			return nil
+		}
+		time.Sleep(time.Second)
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// levenshtein is the edit distance between two strings, in runes.
+func levenshtein(a, b string) int {
+	s, t := []rune(a), []rune(b)
+	prev := make([]int, len(t)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(s); i++ {
+		cur := make([]int, len(t)+1)
+		cur[0] = i
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(t)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
+// suggest picks the candidates closest to what the user typed, best
+// first.  With prefix set, only as much of each candidate as was typed
+// is compared, since instance IDs are usually given abbreviated.
+func suggest(want string, candidates []string, prefix bool) []string {
+	want = strings.ToLower(want)
+	limit := len(want) / 3
+	if limit < 1 {
+		limit = 1
+	}
+
+	type match struct {
+		name string
+		d    int
+	}
+	matches := make([]match, 0)
+	for _, c := range candidates {
+		have := strings.ToLower(c)
+		if prefix && len(have) > len(want) {
+			have = have[:len(want)]
+		}
+		if d := levenshtein(want, have); d <= limit {
+			matches = append(matches, match{c, d})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].d != matches[j].d {
+			return matches[i].d < matches[j].d
+		}
+		return matches[i].name < matches[j].name
+	})
+
+	l := make([]string, 0, 3)
+	for i := 0; i < len(matches) && i < 3; i++ {
+		l = append(l, matches[i].name)
+	}
+	return l
+}
+
+// didYouMean renders suggestions to tack onto an error message,
+// i.e. " -- did you mean 'small' or 'smaller'?"
+func didYouMean(l []string, quote func(string) string) string {
+	if len(l) == 0 {
+		return ""
+	}
+	q := make([]string, len(l))
+	for i, s := range l {
+		q[i] = quote(s)
+	}
+	if len(q) == 1 {
+		return fmt.Sprintf(" -- did you mean %s?", q[0])
+	}
+	return fmt.Sprintf(" -- did you mean %s or %s?", strings.Join(q[:len(q)-1], ", "), q[len(q)-1])
+}
+
+// byPrefix finds the one name that starts with want; if several do,
+// it returns them all (for suggesting), and ok is false.
+func byPrefix(want string, names []string, ignoreCase bool) (int, []string, bool) {
+	found := -1
+	all := make([]string, 0)
+	for i, name := range names {
+		if strings.HasPrefix(name, want) || ignoreCase && strings.HasPrefix(strings.ToLower(name), strings.ToLower(want)) {
+			found = i
+			all = append(all, name)
+		}
+	}
+	if len(all) != 1 {
+		return -1, all, false
+	}
+	return found, nil, true
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/jhunt/go-table"
+	"golang.org/x/sys/unix"
+)
+
+// minCell is as narrow as fitTable will cut a free-text table cell (a
+// dashboard URL, a list of parameters) to make a table fit; past that,
+// the table may as well wrap.
+const minCell = 20
+
+// fitTable lays out a table whose column col holds free text, cutting
+// the lines of that column short only if the table would otherwise be
+// wider than the terminal, and not even then with --wide.
+func fitTable(header []string, rows [][]string, col int) table.Table {
+	if cols := termColumns(os.Stdout); cols > 0 && !opt.Wide {
+		widths := make([]int, len(header))
+		for _, row := range append([][]string{header}, rows...) {
+			for i, cell := range row {
+				for _, line := range strings.Split(cell, "\n") {
+					if n := utf8.RuneCountInString(line); n > widths[i] {
+						widths[i] = n
+					}
+				}
+			}
+		}
+		total := 2 * (len(widths) - 1)
+		for _, w := range widths {
+			total += w
+		}
+		if total > cols {
+			room := cols - (total - widths[col])
+			if room < minCell {
+				room = minCell
+			}
+			for _, row := range rows {
+				row[col] = clip(row[col], room)
+			}
+		}
+	}
+
+	t := table.NewTable(header...)
+	for _, row := range rows {
+		cells := make([]interface{}, len(row))
+		for i := range row {
+			cells[i] = row[i]
+		}
+		t.Row(nil, cells...)
+	}
+	return t
+}
+
+/* how many columns wide the terminal f is, or 0 if it isn't one */
+func termColumns(f *os.File) int {
+	ws, err := unix.IoctlGetWinsize(int(f.Fd()), unix.TIOCGWINSZ)
+	if err != nil {
+		return 0
+	}
+	return int(ws.Col)
+}
+
+/* clip shortens each line of s to n characters */
+func clip(s string, n int) string {
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		if r := []rune(line); len(r) > n {
+			lines[i] = string(r[:n-3]) + "..."
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+var instanceSorts = []string{"id", "name", "service", "plan", "created"}
+
+// sortInstances orders instances by one of instanceSorts (or leaves
+// them as the broker listed them, if key is empty).
+func sortInstances(l []Instance, key string, reverse bool) error {
+	var less func(a, b Instance) bool
+	switch key {
+	case "":
+		return nil
+	case "id":
+		less = func(a, b Instance) bool { return a.ID < b.ID }
+	case "name":
+		less = func(a, b Instance) bool { return a.Name < b.Name }
+	case "service":
+		less = func(a, b Instance) bool { return serviceName(a.Service) < serviceName(b.Service) }
+	case "plan":
+		less = func(a, b Instance) bool { return planName(a.Plan) < planName(b.Plan) }
+	case "created":
+		less = func(a, b Instance) bool { return a.Created.Before(b.Created) }
+	default:
+		return fmt.Errorf("cannot sort instances by '%s' (try one of %s)", key, strings.Join(instanceSorts, ", "))
+	}
+
+	sort.SliceStable(l, func(i, j int) bool {
+		if reverse {
+			return less(l[j], l[i])
+		}
+		return less(l[i], l[j])
+	})
+	return nil
+}
+
+var catalogSorts = []string{"service", "id", "plan"}
+
+// sortCatalog orders services by name or ID; sorting by plan orders
+// the plans within each service by name (and the services by name).
+func sortCatalog(c *Catalog, key string, reverse bool) error {
+	less := func(a, b string) bool { return a < b }
+	if reverse {
+		less = func(a, b string) bool { return a > b }
+	}
+
+	switch key {
+	case "":
+		return nil
+	case "service", "plan":
+		sort.SliceStable(c.Services, func(i, j int) bool {
+			return less(c.Services[i].Name, c.Services[j].Name)
+		})
+	case "id":
+		sort.SliceStable(c.Services, func(i, j int) bool {
+			return less(c.Services[i].ID, c.Services[j].ID)
+		})
+	default:
+		return fmt.Errorf("cannot sort the catalog by '%s' (try one of %s)", key, strings.Join(catalogSorts, ", "))
+	}
+
+	if key == "plan" {
+		for _, s := range c.Services {
+			plans := s.Plans
+			sort.SliceStable(plans, func(i, j int) bool {
+				return less(plans[i].Name, plans[j].Name)
+			})
+		}
+	}
+	return nil
+}
+
+func serviceName(s *Service) string {
+	if s == nil {
+		return ""
+	}
+	if s.Name == "" {
+		return s.ID
+	}
+	return s.Name
+}
+
+func planName(p *Plan) string {
+	if p == nil {
+		return ""
+	}
+	if p.Name == "" {
+		return p.ID
+	}
+	return p.Name
+}
+
+var tableFormats = []string{"table", "json", "csv", "tsv"}
+
+// checkFormat makes sure a command's --format is one we know; json is
+// just another way of saying --json.
+func checkFormat(command, format string) string {
+	switch format {
+	case "", "table":
+		return "table"
+	case "json":
+		opt.JSON = true
+		return format
+	case "csv", "tsv":
+		return format
+	}
+	bad(command, "@R{Unrecognized output format `%s' (try one of %s).}", format, strings.Join(tableFormats, ", "))
+	os.Exit(ExitUsage)
+	return ""
+}
+
+// printRecords prints rows of plain (unstyled) values as CSV or TSV,
+// quoted as spreadsheets expect, under a header row of column names.
+func printRecords(format string, header []string, rows [][]string) {
+	w := csv.NewWriter(os.Stdout)
+	if format == "tsv" {
+		w.Comma = '\t'
+	}
+	w.Write(header)
+	w.WriteAll(rows)
+	bail(w.Error())
+}
+
+var instanceColumns = []string{"id", "name", "service", "service_id", "plan", "plan_id", "created_at", "dashboard_url"}
+
+func instanceRecord(instance Instance) []string {
+	created := ""
+	if !instance.Created.IsZero() {
+		created = instance.Created.UTC().Format(time.RFC3339)
+	}
+	r := []string{instance.ID, instance.Name, "", "", "", "", created, instance.DashboardURL}
+	if instance.Service != nil {
+		r[2], r[3] = instance.Service.Name, instance.Service.ID
+	}
+	if instance.Plan != nil {
+		r[4], r[5] = instance.Plan.Name, instance.Plan.ID
+	}
+	return r
+}
+
+var catalogColumns = []string{"service", "service_id", "plan", "plan_id", "limit", "parameters", "tags"}
+
+/* one record per plan, since spreadsheets don't do multi-line cells well */
+func catalogRecords(catalog Catalog) [][]string {
+	rows := make([][]string, 0)
+	for _, s := range catalog.Services {
+		tags := strings.Join(s.Tags, " ")
+		if len(s.Plans) == 0 {
+			rows = append(rows, []string{s.Name, s.ID, "", "", "", "", tags})
+		}
+		for _, p := range s.Plans {
+			names := make([]string, 0)
+			for _, f := range SchemaFields(p.CreateSchema()) {
+				names = append(names, f.Name)
+			}
+			limit := ""
+			if p.Limit() > 0 {
+				limit = strconv.Itoa(p.Limit())
+			}
+			rows = append(rows, []string{s.Name, s.ID, p.Name, p.ID, limit, strings.Join(names, " "), tags})
+		}
+	}
+	return rows
+}
+
+var capacityColumns = []string{"service", "plan", "instances", "limit", "vms_per_instance", "disk_mb_per_vm", "total_vms", "total_disk_mb"}
+
+func capacityRecords(plans []Capacity) [][]string {
+	rows := make([][]string, 0, len(plans))
+	for _, p := range plans {
+		rows = append(rows, []string{p.Service.Name, p.Plan.Name,
+			strconv.Itoa(p.Used), strconv.Itoa(p.Limit),
+			strconv.Itoa(p.VMs), strconv.Itoa(p.DiskMB),
+			strconv.Itoa(p.TotalVMs()), strconv.Itoa(p.TotalDiskMB())})
+	}
+	return rows
+}
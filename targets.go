@@ -0,0 +1,97 @@
+package main
+
+import (
+	"os"
+
+	fmt "github.com/jhunt/boss/ansi"
+	"github.com/jhunt/go-table"
+)
+
+// connectTo is connect, but for some other configured target; nothing
+// about the current target (its credentials least of all) carries over.
+func connectTo(url string, target *Target) *Client {
+	if url == opt.URL {
+		return connect()
+	}
+	return newClient(url, target, target.Username, target.Password)
+}
+
+type targetInstances struct {
+	broker    string
+	instances []Instance
+	err       error
+}
+
+func listAllTargets(format string) {
+	cfg, err := ReadConfig()
+	bail(err)
+	if len(cfg.Targets) == 0 {
+		bail(fmt.Errorf("no targets configured (try `boss target NAME`)"))
+	}
+
+	urls := cfg.URLs()
+	results := make([]targetInstances, len(urls))
+	jobs := make([]Job, len(urls))
+	for i, url := range urls {
+		i, url := i, url
+		jobs[i] = Job{
+			Name: cfg.Label(url),
+			Run: func() error {
+				instances, err := connectTo(url, cfg.Targets[url]).Instances()
+				results[i] = targetInstances{broker: cfg.Label(url), instances: instances, err: err}
+				return nil /* reported below, where partial results are okay */
+			},
+		}
+	}
+	pool := bulkPool(0, len(urls))
+	pool.Out = nil
+	pool.Run(jobs)
+
+	failed := 0
+	rows := make([][]string, 0)
+	all := ListV1{Schema: schemaName("list", opt.OutputSchema), Instances: make([]InstanceV1, 0)}
+	for _, r := range results {
+		if r.err != nil {
+			fmt.Fprintf(os.Stderr, "@Y{WARNING: %s: %s}\n", r.broker, r.err)
+			if _, partial := r.err.(CatalogUnavailableError); !partial {
+				failed++
+				continue
+			}
+		}
+		sortInstances(r.instances, opt.Sort, opt.Reverse)
+		for _, instance := range r.instances {
+			rows = append(rows, append([]string{r.broker}, instanceRecord(instance)...))
+			out := instanceV1(instance)
+			out.Broker = r.broker
+			all.Instances = append(all.Instances, out)
+		}
+	}
+
+	if opt.JSON {
+		printJSON(all)
+	} else if format != "table" {
+		printRecords(format, append([]string{"broker"}, instanceColumns...), rows)
+	} else if len(all.Instances) == 0 {
+		fmt.Printf("@Y{No Blacksmith service instances found.}\n")
+	} else {
+		t := table.NewTable("Broker", "ID", "Service", "Plan")
+		for _, instance := range all.Instances {
+			t.Row(nil, instance.Broker, instance.ID, refName(instance.Service), refName(instance.Plan))
+		}
+		t.Output(os.Stdout)
+	}
+
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+func refName(r *RefV1) string {
+	switch {
+	case r == nil:
+		return "(unknown)"
+	case r.Name == "":
+		return r.ID
+	}
+	return r.Name
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/jhunt/boss/ansi"
+)
+
+// themes map markup to what to draw it with instead.  boss uses red
+// for failures, green for success, yellow for warnings, cyan for
+// commands and magenta for instances; themes should keep those apart.
+var themes = map[string]map[string]string{
+	"default": {},
+
+	/* red and green are the two colors most often confused, so
+	   success is blue, and failure is red, reversed */
+	"colorblind": {
+		"g": "00;34", "G": "01;34",
+		"r": "04;31", "R": "07;31",
+		"b": "00;36", "B": "01;36",
+	},
+
+	/* bold, but no colors, for monochrome terminals */
+	"mono": {
+		"k": "00", "K": "01",
+		"r": "00", "R": "01",
+		"g": "00", "G": "01",
+		"y": "00", "Y": "01",
+		"b": "00", "B": "01",
+		"m": "00", "M": "01",
+		"p": "00", "P": "01",
+		"c": "00", "C": "01",
+		"w": "00", "W": "01",
+	},
+
+	/* nothing but the text */
+	"none": nil,
+}
+
+func themeNames() []string {
+	l := make([]string, 0, len(themes))
+	for name := range themes {
+		l = append(l, name)
+	}
+	sort.Strings(l)
+	return l
+}
+
+// applyTheme sets up how output looks, per --theme and --ascii.  ASCII
+// mode turns colors off whatever the theme; whether progress is redrawn
+// is down to whether it's going to a terminal, not to how it looks.
+func applyTheme() error {
+	name := opt.Theme
+	if name == "" {
+		name = "default"
+	}
+	theme, ok := themes[name]
+	if !ok {
+		return fmt.Errorf("unrecognized theme '%s' (try one of %s)", name, strings.Join(themeNames(), ", "))
+	}
+
+	if theme == nil || opt.ASCII {
+		ansi.ForceColor(false)
+		return nil
+	}
+	ansi.SetColors(theme)
+	return nil
+}
+
+// isTTY is whether f is a terminal at all.
+func isTTY(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"net/http"
+)
+
+// Tracer starts spans for broker requests.  It is deliberately small,
+// so that an OpenTelemetry TracerProvider (or anything else) can be
+// adapted to it in a few lines, without boss depending on it.
+type Tracer interface {
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+type Span interface {
+	SetAttribute(key string, value interface{})
+	RecordError(err error)
+	End()
+}
+
+func (c *Client) startSpan(method, path, rid string) (context.Context, Span) {
+	ctx := c.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if c.Tracer == nil {
+		return ctx, nil
+	}
+
+	ctx, span := c.Tracer.Start(ctx, "blacksmith "+method+" "+Route(path))
+	span.SetAttribute("http.method", method)
+	span.SetAttribute("http.route", Route(path))
+	span.SetAttribute("blacksmith.request_id", rid)
+	return ctx, span
+}
+
+func endSpan(span Span, res *http.Response, err error, retries int) {
+	if span == nil {
+		return
+	}
+
+	span.SetAttribute("blacksmith.retries", retries)
+	if res != nil {
+		span.SetAttribute("http.status_code", res.StatusCode)
+	}
+	if err != nil {
+		span.RecordError(err)
+	}
+	span.End()
+}
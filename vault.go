@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Vault is just enough of a Vault client to store secrets, in either
+// version of the KV secrets engine.  It is configured from $VAULT_ADDR
+// and $VAULT_TOKEN (or ~/.vault-token), or failing that from the
+// current target of the safe CLI, in ~/.saferc.
+type Vault struct {
+	Addr      string
+	Token     string
+	Namespace string
+	DryRun    bool
+
+	ua *http.Client
+}
+
+func VaultFromEnv() (*Vault, error) {
+	v := &Vault{
+		Addr:      os.Getenv("VAULT_ADDR"),
+		Token:     os.Getenv("VAULT_TOKEN"),
+		Namespace: os.Getenv("VAULT_NAMESPACE"),
+	}
+	ca := os.Getenv("VAULT_CACERT")
+	skip := os.Getenv("VAULT_SKIP_VERIFY") != "" && os.Getenv("VAULT_SKIP_VERIFY") != "false"
+
+	home, _ := os.UserHomeDir()
+	if v.Addr == "" {
+		if err := v.fromSafe(filepath.Join(home, ".saferc"), &skip); err != nil {
+			return nil, err
+		}
+	}
+	if v.Token == "" {
+		b, _ := ioutil.ReadFile(filepath.Join(home, ".vault-token"))
+		v.Token = strings.TrimSpace(string(b))
+	}
+	if v.Addr == "" || v.Token == "" {
+		return nil, fmt.Errorf("set $VAULT_ADDR and $VAULT_TOKEN (or target a vault with safe) first")
+	}
+	v.Addr = strings.TrimSuffix(v.Addr, "/")
+
+	ua, err := tlsClient(ca, skip)
+	if err != nil {
+		return nil, err
+	}
+	v.ua = ua
+	return v, nil
+}
+
+func (v *Vault) fromSafe(path string, skip *bool) error {
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	raw, err := parseYAML(string(b))
+	if err != nil {
+		return fmt.Errorf("%s: %s", path, err)
+	}
+
+	rc := asMap(raw)
+	target := asMap(asMap(rc["vaults"])[asString(rc["current"])])
+	if target == nil {
+		return nil
+	}
+	v.Addr = asString(target["url"])
+	v.Token = asString(target["token"])
+	v.Namespace = asString(target["namespace"])
+	*skip = *skip || asString(target["skip_verify"]) == "true"
+	return nil
+}
+
+func (v *Vault) do(method, path string, in interface{}, out interface{}) error {
+	var body *bytes.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	} else {
+		body = bytes.NewReader(nil)
+	}
+
+	req, err := http.NewRequest(method, v.Addr+"/v1/"+strings.TrimPrefix(path, "/"), body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Vault-Token", v.Token)
+	if v.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.Namespace)
+	}
+
+	res, err := v.ua.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		var e struct {
+			Errors []string `json:"errors"`
+		}
+		json.Unmarshal(b, &e)
+		if len(e.Errors) > 0 {
+			return fmt.Errorf("vault: %s %s: %s", method, path, strings.Join(e.Errors, "; "))
+		}
+		return fmt.Errorf("vault: %s %s: %s", method, path, res.Status)
+	}
+	if out != nil && len(b) > 0 {
+		return json.Unmarshal(b, out)
+	}
+	return nil
+}
+
+/* kv v2 keeps secrets under MOUNT/data/..., so we need to know which we have */
+func (v *Vault) kvPath(path string) (string, bool) {
+	var mount struct {
+		Data struct {
+			Path    string `json:"path"`
+			Options struct {
+				Version string `json:"version"`
+			} `json:"options"`
+		} `json:"data"`
+	}
+	if err := v.do("GET", "sys/internal/ui/mounts/"+path, nil, &mount); err != nil {
+		return path, false
+	}
+	if mount.Data.Options.Version != "2" || !strings.HasPrefix(path, mount.Data.Path) {
+		return path, false
+	}
+	return mount.Data.Path + "data/" + strings.TrimPrefix(path, mount.Data.Path), true
+}
+
+// Write stores a secret at path, replacing whatever was there.
+func (v *Vault) Write(path string, data map[string]interface{}) error {
+	path = strings.Trim(path, "/")
+	if v.DryRun {
+		fmt.Fprintf(os.Stdout, "[dry-run] PUT %s/v1/%s\n", v.Addr, path)
+		return nil
+	}
+
+	full, v2 := v.kvPath(path)
+	if v2 {
+		return v.do("PUT", full, map[string]interface{}{"data": data}, nil)
+	}
+	return v.do("PUT", full, data, nil)
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const DefaultAPIVersion = "2.14"
+
+/* OSB API versions we know how to speak, newest first */
+var APIVersions = []string{"2.16", "2.15", "2.14", "2.13", "2.12", "2.11"}
+
+type Capabilities struct {
+	APIVersion        string
+	BlacksmithVersion string
+	Latency           time.Duration
+}
+
+func (c *Client) apiVersion() string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.Capabilities != nil {
+		return c.Capabilities.APIVersion
+	}
+	if c.APIVersion != "" {
+		return c.APIVersion
+	}
+	return DefaultAPIVersion
+}
+
+func (c *Client) Supports(version string) bool {
+	return compareVersions(c.apiVersion(), version) >= 0
+}
+
+func compareVersions(a, b string) int {
+	as := strings.Split(a, ".")
+	bs := strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// Ping probes the broker for the newest OSB API version it will
+// accept (brokers reject versions they don't support with a 412),
+// and records what it learns on the client for subsequent calls.
+func (c *Client) Ping() (*Capabilities, error) {
+	c.init()
+	c.ping.Lock()
+	defer c.ping.Unlock()
+
+	versions := APIVersions
+	if c.APIVersion != "" {
+		versions = []string{c.APIVersion}
+	}
+
+	/* the broker has Timeout (or 30s) to answer; other calls can wait */
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	ua := &http.Client{Timeout: timeout, Transport: c.ua.Transport}
+
+	var last error
+	for _, v := range versions {
+		start := time.Now()
+		res, err := c.exec(ua, v, "GET", "/v2/catalog", nil)
+		if err != nil {
+			return nil, err
+		}
+		b, _ := ioutil.ReadAll(io.LimitReader(res.Body, 1<<20))
+		res.Body.Close()
+
+		if res.StatusCode == 412 {
+			c.Logger.Debugf("broker rejected OSB API version", "version", v)
+			last = apiError(res, b)
+			continue
+		}
+		if res.StatusCode < 200 || res.StatusCode > 299 {
+			return nil, apiError(res, b)
+		}
+
+		caps := &Capabilities{
+			APIVersion:        v,
+			BlacksmithVersion: res.Header.Get("X-Blacksmith-Version"),
+			Latency:           time.Since(start),
+		}
+		if echo := res.Header.Get("X-Broker-API-Version"); echo != "" && compareVersions(echo, v) < 0 {
+			caps.APIVersion = echo
+		}
+
+		c.lock.Lock()
+		c.Capabilities = caps
+		c.lock.Unlock()
+
+		c.Logger.Debugf("negotiated OSB API version", "version", caps.APIVersion, "blacksmith", caps.BlacksmithVersion)
+		return caps, nil
+	}
+
+	if last == nil {
+		last = fmt.Errorf("unable to negotiate an OSB API version with the broker")
+	}
+	return nil, last
+}
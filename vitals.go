@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// Vitals are the resource usage of a single VM, as its BOSH agent
+// reports it.  Like the director, Blacksmith hands these over as
+// strings (i.e. "12.5"), which may be missing if the agent is down.
+type Vitals struct {
+	CPU struct {
+		User string `json:"user"`
+		Sys  string `json:"sys"`
+		Wait string `json:"wait"`
+	} `json:"cpu"`
+	Mem struct {
+		KB      string `json:"kb"`
+		Percent string `json:"percent"`
+	} `json:"mem"`
+	Disk map[string]struct {
+		Percent string `json:"percent"`
+	} `json:"disk"`
+	Load []string `json:"load"`
+}
+
+// Process is one monit-managed process on a VM.
+type Process struct {
+	Name  string `json:"name"`
+	State string `json:"state"`
+}
+
+func (p Process) Running() bool {
+	return p.State == "running"
+}
+
+// VMMetrics is a VM, along with its vitals and processes.
+type VMMetrics struct {
+	VM
+	Vitals    Vitals    `json:"vitals"`
+	Processes []Process `json:"processes"`
+}
+
+// CPU is the share of CPU time spent not idling, as a percentage,
+// or -1 if the agent didn't say.
+func (m VMMetrics) CPU() float64 {
+	total, ok := 0.0, false
+	for _, s := range []string{m.Vitals.CPU.User, m.Vitals.CPU.Sys, m.Vitals.CPU.Wait} {
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			total, ok = total+f, true
+		}
+	}
+	if !ok {
+		return -1
+	}
+	return total
+}
+
+// DiskPercent is how full the named disk (system, ephemeral or
+// persistent) is, or "" if the VM doesn't have one.
+func (m VMMetrics) DiskPercent(disk string) string {
+	return m.Vitals.Disk[disk].Percent
+}
+
+// Failing lists the processes on the VM that aren't running.
+func (m VMMetrics) Failing() []string {
+	l := make([]string, 0)
+	for _, p := range m.Processes {
+		if !p.Running() {
+			l = append(l, fmt.Sprintf("%s (%s)", p.Name, p.State))
+		}
+	}
+	return l
+}
+
+func (c *Client) Vitals(id string) ([]VMMetrics, error) {
+	out := make([]VMMetrics, 0)
+	_, err := c.request("GET", fmt.Sprintf("/b/%s/vitals.json", id), nil, &out)
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Group != out[j].Group {
+			return out[i].Group < out[j].Group
+		}
+		return out[i].Index < out[j].Index
+	})
+	return out, err
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// VM is one BOSH VM in the deployment behind a service instance,
+// as reported by the director (by way of Blacksmith).
+type VM struct {
+	Group string   `json:"job_name"`
+	Index int      `json:"index"`
+	ID    string   `json:"id"`
+	IPs   []string `json:"ips"`
+	AZ    string   `json:"az"`
+	State string   `json:"process_state"`
+	CID   string   `json:"vm_cid"`
+}
+
+func (v VM) String() string {
+	if v.ID != "" {
+		return fmt.Sprintf("%s/%s", v.Group, v.ID)
+	}
+	return fmt.Sprintf("%s/%d", v.Group, v.Index)
+}
+
+func (v VM) Running() bool {
+	return v.State == "running"
+}
+
+func (c *Client) VMs(id string) ([]VM, error) {
+	out := make([]VM, 0)
+	_, err := c.request("GET", fmt.Sprintf("/b/%s/vms.json", id), nil, &out)
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Group != out[j].Group {
+			return out[i].Group < out[j].Group
+		}
+		return out[i].Index < out[j].Index
+	})
+	return out, err
+}
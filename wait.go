@@ -0,0 +1,172 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// DurationStore remembers how long operations on each plan usually
+// take, so that waits can poll less often while nothing is expected
+// to have happened yet.
+type DurationStore interface {
+	Expected(plan, kind string) time.Duration
+	Record(plan, kind string, took time.Duration)
+}
+
+type poller struct {
+	interval time.Duration
+	max      time.Duration
+	start    time.Time
+	expected time.Duration
+}
+
+func (c *Client) poller(plan, kind string) *poller {
+	p := &poller{
+		interval: c.PollInterval,
+		max:      c.MaxPollInterval,
+		start:    time.Now(),
+	}
+	if p.interval <= 0 {
+		p.interval = time.Second
+	}
+	if p.max <= 0 {
+		p.max = 30 * time.Second
+	}
+	if c.Durations != nil {
+		p.expected = c.Durations.Expected(plan, kind)
+	}
+	return p
+}
+
+// next starts fast and backs off to a cap, skipping ahead when we
+// know the operation usually takes a while; a broker-supplied
+// Retry-After always wins.
+func (p *poller) next(hint time.Duration) time.Duration {
+	if hint > 0 {
+		return hint
+	}
+
+	d := p.interval
+	if p.expected > 0 {
+		if remaining := p.expected - time.Since(p.start); remaining/2 > d {
+			d = remaining / 2
+		}
+	}
+	if d > p.max {
+		d = p.max
+	}
+
+	p.interval = p.interval * 3 / 2
+	if p.interval > p.max {
+		p.interval = p.max
+	}
+	return d
+}
+
+func (p *poller) wait(hint time.Duration) {
+	time.Sleep(p.next(hint))
+}
+
+func (c *Client) waitFor(id string, ref instanceRef, operation string, deleting bool, timeout time.Duration) (Operation, error) {
+	kind := "deploy"
+	if deleting {
+		kind = "delete"
+	}
+	return c.poll(id, ref.PlanID, kind, deleting, timeout, func() (Operation, error) {
+		return c.lastOperation(id, ref, operation)
+	})
+}
+
+// poll checks an operation's progress until it succeeds, fails or
+// runs out of time.  When deleting, "not found" means success.
+func (c *Client) poll(id, plan, kind string, deleting bool, timeout time.Duration, check func() (Operation, error)) (op Operation, err error) {
+	defer func() { c.progressDone(id, err) }()
+
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+
+	p := c.poller(plan, kind)
+	for {
+		op, err := check()
+		if deleting && errors.Is(err, ErrNotFound) {
+			/* the broker has forgotten about it; it's gone */
+			return Operation{State: "succeeded"}, nil
+		}
+		if err != nil {
+			return op, err
+		}
+
+		switch op.State {
+		case "succeeded":
+			if c.Durations != nil {
+				c.Durations.Record(plan, kind, time.Since(p.start))
+			}
+			return op, nil
+		case "failed":
+			return op, OperationFailedError{ID: id, Description: op.Description}
+		}
+
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			return op, TimeoutError{ID: id, Timeout: timeout}
+		}
+		c.progress(id, kind, op, time.Since(p.start))
+		p.wait(op.RetryAfter)
+	}
+}
+
+// StateDurations is a DurationStore kept in ~/.boss/durations.json,
+// as a moving average per plan and kind of operation.
+type StateDurations struct {
+	lock sync.Mutex
+}
+
+func (s *StateDurations) Expected(plan, kind string) time.Duration {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var all map[string]time.Duration
+	if err := readState("durations.json", &all); err != nil {
+		return 0
+	}
+	return all[plan+"/"+kind]
+}
+
+func (s *StateDurations) Record(plan, kind string, took time.Duration) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	all := make(map[string]time.Duration)
+	if err := readState("durations.json", &all); err != nil {
+		return
+	}
+
+	key := plan + "/" + kind
+	if prev, ok := all[key]; ok {
+		took = (prev*3 + took) / 4
+	}
+	all[key] = took
+	writeState("durations.json", all)
+}
+
+// Wait blocks until an instance's last operation succeeds or fails.
+// If gone is set, it instead waits for the broker to forget about
+// the instance entirely, as it does once deprovisioning finishes.
+func (c *Client) Wait(id string, gone bool, timeout time.Duration) (Operation, error) {
+	start := time.Now()
+	ref, err := c.instanceRef(id)
+	if gone && errors.Is(err, ErrNotFound) {
+		return Operation{State: "succeeded"}, nil
+	}
+	if err != nil {
+		return Operation{}, err
+	}
+
+	op, err := c.waitFor(id, ref, "", gone, timeout)
+	if err != nil || !gone {
+		return op, err
+	}
+	return op, c.waitGone(id, ref, start, timeout)
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+/* boss reads and writes YAML with gopkg.in/yaml.v3, but hands the rest
+   of the code the same generic values that encoding/json would: maps
+   with string keys, []interface{}, strings, numbers, booleans and nil.
+   aliases are expanded, merge keys (<<) are merged, and timestamps are
+   left as the strings they were written as. */
+
+func parseYAML(src string) (interface{}, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(src), &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 {
+		return nil, nil
+	}
+	return yamlValue(doc.Content[0])
+}
+
+func yamlValue(n *yaml.Node) (interface{}, error) {
+	switch n.Kind {
+	case yaml.DocumentNode:
+		if len(n.Content) == 0 {
+			return nil, nil
+		}
+		return yamlValue(n.Content[0])
+
+	case yaml.AliasNode:
+		return yamlValue(n.Alias)
+
+	case yaml.SequenceNode:
+		l := make([]interface{}, 0, len(n.Content))
+		for _, item := range n.Content {
+			v, err := yamlValue(item)
+			if err != nil {
+				return nil, err
+			}
+			l = append(l, v)
+		}
+		return l, nil
+
+	case yaml.MappingNode:
+		m := make(map[string]interface{}, len(n.Content)/2)
+		merged := make([]map[string]interface{}, 0)
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			k, v := n.Content[i], n.Content[i+1]
+			val, err := yamlValue(v)
+			if err != nil {
+				return nil, err
+			}
+			if k.ShortTag() == "!!merge" {
+				switch val := val.(type) {
+				case map[string]interface{}:
+					merged = append(merged, val)
+				case []interface{}:
+					for _, each := range val {
+						if mm, ok := each.(map[string]interface{}); ok {
+							merged = append(merged, mm)
+						}
+					}
+				}
+				continue
+			}
+			if k.Kind != yaml.ScalarNode {
+				return nil, fmt.Errorf("yaml line %d: only scalar map keys are supported", k.Line)
+			}
+			m[k.Value] = val
+		}
+		/* explicit keys win over merged ones, and earlier merges over later */
+		for _, mm := range merged {
+			for key, val := range mm {
+				if _, ok := m[key]; !ok {
+					m[key] = val
+				}
+			}
+		}
+		return m, nil
+
+	case yaml.ScalarNode:
+		if n.ShortTag() == "!!timestamp" {
+			return n.Value, nil
+		}
+		var v interface{}
+		if err := n.Decode(&v); err != nil {
+			return nil, err
+		}
+		return v, nil
+	}
+	return nil, fmt.Errorf("yaml line %d: unsupported node", n.Line)
+}
+
+// marshalYAML renders any JSON-serializable value as YAML,
+// with map keys in sorted order so that output is stable.
+func marshalYAML(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+
+	var generic interface{}
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	if err := d.Decode(&generic); err != nil {
+		return "", err
+	}
+
+	var out bytes.Buffer
+	enc := yaml.NewEncoder(&out)
+	enc.SetIndent(2)
+	if err := enc.Encode(yamlNumbers(generic)); err != nil {
+		return "", err
+	}
+	if err := enc.Close(); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+/* json.Numbers are strings, as far as the YAML encoder is concerned */
+func yamlNumbers(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k := range v {
+			v[k] = yamlNumbers(v[k])
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = yamlNumbers(v[i])
+		}
+	case json.Number:
+		if i, err := strconv.ParseInt(string(v), 10, 64); err == nil {
+			return i
+		}
+		if f, err := strconv.ParseFloat(string(v), 64); err == nil {
+			return f
+		}
+		return string(v)
+	}
+	return v
+}
+
+// marshalNode writes out a YAML document as parsed into nodes, keeping
+// the styles (and anchors, and comments) that it was written with.
+func marshalNode(n *yaml.Node) (string, error) {
+	var out bytes.Buffer
+	enc := yaml.NewEncoder(&out)
+	enc.SetIndent(2)
+	if err := enc.Encode(n); err != nil {
+		return "", err
+	}
+	if err := enc.Close(); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
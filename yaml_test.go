@@ -0,0 +1,85 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseYAML(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want interface{}
+	}{
+		{"quoted yes", `a: "yes"`, map[string]interface{}{"a": "yes"}},
+		{"quoted on", `a: "on"`, map[string]interface{}{"a": "on"}},
+		{"quoted leading zero", `a: "0123"`, map[string]interface{}{"a": "0123"}},
+		{"quoted float", `a: "1.10"`, map[string]interface{}{"a": "1.10"}},
+		{"timestamps stay strings", `a: 2001-12-14`, map[string]interface{}{"a": "2001-12-14"}},
+		{"anchors and aliases", "a: &x {k: v}\nb: *x\n", map[string]interface{}{
+			"a": map[string]interface{}{"k": "v"},
+			"b": map[string]interface{}{"k": "v"},
+		}},
+		{"merge keys", "base: &b {k: v, n: 1}\nc:\n  <<: *b\n  n: 2\n", map[string]interface{}{
+			"base": map[string]interface{}{"k": "v", "n": 1},
+			"c":    map[string]interface{}{"k": "v", "n": 2},
+		}},
+		{"multi-line flow sequence", "a: [1,\n  2]\n", map[string]interface{}{"a": []interface{}{1, 2}}},
+		{"literal block", "a: |\n  one\n  two\n", map[string]interface{}{"a": "one\ntwo\n"}},
+		{"numeric keys", "1: one\n", map[string]interface{}{"1": "one"}},
+		{"empty", "", nil},
+	}
+
+	for _, test := range tests {
+		got, err := parseYAML(test.src)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %#v, want %#v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestMarshalYAMLQuotesAmbiguousStrings(t *testing.T) {
+	/* every one of these is something other than a string to a YAML 1.1
+	   (or 1.2) reader, unless it is quoted */
+	for _, s := range []string{
+		"yes", "no", "on", "off", "y", "n", "Yes", "NO", "true", "False",
+		"null", "~", "", "0123", "1.10", "6.0", "0x1F", "0o17", "1_000",
+		"1e3", ".inf", ".NaN", "12:30", "2001-12-14",
+	} {
+		out, err := marshalYAML(map[string]interface{}{"v": s})
+		if err != nil {
+			t.Errorf("%q: unexpected error: %s", s, err)
+			continue
+		}
+		back, err := parseYAML(out)
+		if err != nil {
+			t.Errorf("%q: unable to read back %q: %s", s, out, err)
+			continue
+		}
+		if got := asMap(back)["v"]; got != s {
+			t.Errorf("%q: came back as %#v (from %q)", s, got, out)
+		}
+		if out == "v: "+s+"\n" {
+			t.Errorf("%q: was not quoted", s)
+		}
+	}
+}
+
+func TestMarshalYAML(t *testing.T) {
+	out, err := marshalYAML(map[string]interface{}{
+		"b":    []interface{}{1, "two"},
+		"a":    500,
+		"cert": "-----BEGIN-----\nabc\n-----END-----\n",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	want := "a: 500\nb:\n  - 1\n  - two\ncert: |\n  -----BEGIN-----\n  abc\n  -----END-----\n"
+	if out != want {
+		t.Errorf("got:\n%s\nwant:\n%s", out, want)
+	}
+}